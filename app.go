@@ -1,12 +1,14 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/trzsz/iterm2/api"
 	"github.com/trzsz/iterm2/client"
@@ -22,13 +24,24 @@ func NewApp(name string) (*App, error) {
 	return newApp(c), nil
 }
 
+// NewAppWithOptions is like NewApp but configures the connection to iTerm2 with opts,
+// e.g. to reconnect automatically after iTerm2 restarts.
+func NewAppWithOptions(name string, opts client.Options) (*App, error) {
+	c, err := client.NewWithOptions(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newApp(c), nil
+}
+
 // App represents an open iTerm2 application instance
 type App struct {
-	c *client.Client
+	c     *client.Client
+	cache atomic.Pointer[StateCache]
 }
 
 func newApp(c *client.Client) *App {
-	return &App{c}
+	return &App{c: c}
 }
 
 // Close closes the iTerm2 application connection
@@ -36,28 +49,47 @@ func (a *App) Close() error {
 	return a.c.Close()
 }
 
+// Shutdown closes the iTerm2 application connection after the calls in flight
+// have completed or ctx is done, see client.Client.Shutdown
+func (a *App) Shutdown(ctx context.Context) error {
+	return a.c.Shutdown(ctx)
+}
+
 // IsClosed reports whether the iTerm2 application connection has been closed
 func (a *App) IsClosed() bool {
 	return a.c.IsClosed()
 }
 
+// Client returns the underlying client, e.g. to send raw messages with Call
+// or to subscribe to notifications that have no wrapper in this package
+func (a *App) Client() *client.Client {
+	return a.c
+}
+
+// OnDisconnect registers fn to be called when the connection to iTerm2 is lost unexpectedly.
+// The error passed to fn matches ErrConnectionLost with errors.Is.
+// With the Reconnect option the App keeps running and tries to reconnect afterwards.
+func (a *App) OnDisconnect(fn func(error)) {
+	a.c.OnDisconnect(fn)
+}
+
+// OnReconnect registers fn to be called after the connection to iTerm2 has been re-established.
+// It is only called for an App created with the Reconnect option.
+func (a *App) OnReconnect(fn func()) {
+	a.c.OnReconnect(fn)
+}
+
 // CreateWindow creates a new terminal window in iTerm2
 func (a *App) CreateWindow() (*Window, *Session, error) {
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{
-			CreateTabRequest: &api.CreateTabRequest{},
-		},
-	})
-	if err != nil {
-		return nil, nil, fmt.Errorf("call create_tab_request failed: %w", err)
-	}
+	return a.CreateWindowContext(context.Background())
+}
 
-	ctResp := resp.GetCreateTabResponse()
-	if ctResp == nil {
-		return nil, nil, fmt.Errorf("create_tab_response is nil")
-	}
-	if ctResp.GetStatus() != api.CreateTabResponse_OK {
-		return nil, nil, fmt.Errorf("create_tab_response status is not ok: %v", ctResp.GetStatus())
+// CreateWindowContext is like CreateWindow but takes a context
+func (a *App) CreateWindowContext(ctx context.Context) (*Window, *Session, error) {
+	ctResp, err := Do[*api.CreateTabResponse](ctx, a, &api.CreateTabRequest{})
+	a.invalidateCache()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	session := newSession(a, ctResp.GetWindowId(), strconv.Itoa(int(ctResp.GetTabId())), ctResp.GetSessionId())
@@ -66,57 +98,48 @@ func (a *App) CreateWindow() (*Window, *Session, error) {
 
 // ListWindows retrieves all terminal windows in iTerm2
 func (a *App) ListWindows() ([]*Window, error) {
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
-			ListSessionsRequest: &api.ListSessionsRequest{},
-		},
-	})
+	return a.ListWindowsContext(context.Background())
+}
+
+// ListWindowsContext is like ListWindows but takes a context
+func (a *App) ListWindowsContext(ctx context.Context) ([]*Window, error) {
+	layout, err := a.LayoutContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("call list_sessions_request failed: %w", err)
-	}
-	lsResp := resp.GetListSessionsResponse()
-	if lsResp == nil {
-		return nil, fmt.Errorf("list_sessions_response is nil")
+		return nil, err
 	}
-	windows := lsResp.GetWindows()
-	list := make([]*Window, 0, len(windows))
-	for _, w := range windows {
-		list = append(list, newWindow(a, w.GetWindowId()))
+	list := make([]*Window, 0, len(layout.Windows))
+	for _, w := range layout.Windows {
+		list = append(list, newWindow(a, w.ID))
 	}
 	return list, nil
 }
 
 // SelectMenuItem selects a menu item
 func (a *App) SelectMenuItem(item string) error {
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_MenuItemRequest{
-			MenuItemRequest: &api.MenuItemRequest{
-				Identifier: &item,
-			},
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("call menu_item_request failed: %w", err)
-	}
+	return a.SelectMenuItemContext(context.Background(), item)
+}
 
-	miResp := resp.GetMenuItemResponse()
-	if miResp == nil {
-		return fmt.Errorf("menu_item_response is nil")
-	}
-	if miResp.GetStatus() != api.MenuItemResponse_OK {
-		return fmt.Errorf("menu_item_response status is not ok: %v", miResp.GetStatus())
-	}
-	return nil
+// SelectMenuItemContext is like SelectMenuItem but takes a context
+func (a *App) SelectMenuItemContext(ctx context.Context, item string) error {
+	_, err := Do[*api.MenuItemResponse](ctx, a, &api.MenuItemRequest{
+		Identifier: &item,
+	})
+	return err
 }
 
 // GetCurrentHostSession returns the session that the current process belongs to
 func (a *App) GetCurrentHostSession() (*Session, error) {
+	return a.GetCurrentHostSessionContext(context.Background())
+}
+
+// GetCurrentHostSessionContext is like GetCurrentHostSession but takes a context
+func (a *App) GetCurrentHostSessionContext(ctx context.Context) (*Session, error) {
 	sessionId := os.Getenv("ITERM_SESSION_ID")
 	if sessionId == "" {
 		return nil, fmt.Errorf("ITERM_SESSION_ID is not set")
 	}
 
-	session, err := findSessionByMatch(a, func(wid, tid, sid string) bool {
+	session, err := findSessionByMatch(ctx, a, func(wid, tid, sid string) bool {
 		return sid != "" && strings.Contains(sessionId, sid)
 	})
 	if err != nil {
@@ -128,19 +151,13 @@ func (a *App) GetCurrentHostSession() (*Session, error) {
 	return session, nil
 }
 
-func (a *App) getFocusInfo() (string, []string, []string, error) {
-	focusResp, err := a.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_FocusRequest{
-			FocusRequest: &api.FocusRequest{},
-		},
-	})
-	if err != nil {
-		return "", nil, nil, fmt.Errorf("call focus_request failed: %w", err)
+func (a *App) getFocusInfo(ctx context.Context) (string, []string, []string, error) {
+	if c := a.cache.Load(); c != nil {
+		return c.focus(ctx)
 	}
-
-	fResp := focusResp.GetFocusResponse()
-	if fResp == nil {
-		return "", nil, nil, fmt.Errorf("focus_response is nil")
+	fResp, err := Do[*api.FocusResponse](ctx, a, &api.FocusRequest{})
+	if err != nil {
+		return "", nil, nil, err
 	}
 
 	var windows []*api.FocusChangedNotification_Window
@@ -173,12 +190,17 @@ func (a *App) getFocusInfo() (string, []string, []string, error) {
 
 // GetCurrentActiveSession returns the session that currently has user focus
 func (a *App) GetCurrentActiveSession() (*Session, error) {
-	focusWid, focusTabs, focusSessions, err := a.getFocusInfo()
+	return a.GetCurrentActiveSessionContext(context.Background())
+}
+
+// GetCurrentActiveSessionContext is like GetCurrentActiveSession but takes a context
+func (a *App) GetCurrentActiveSessionContext(ctx context.Context) (*Session, error) {
+	focusWid, focusTabs, focusSessions, err := a.getFocusInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	session, err := findSessionByMatch(a, func(wid, tid, sid string) bool {
+	session, err := findSessionByMatch(ctx, a, func(wid, tid, sid string) bool {
 		return wid == focusWid && slices.Contains(focusTabs, tid) && slices.Contains(focusSessions, sid)
 	})
 	if err != nil {
@@ -192,35 +214,40 @@ func (a *App) GetCurrentActiveSession() (*Session, error) {
 
 // GetCurrentTmuxSession returns any available tmux session related to the current process, active preferred
 func (a *App) GetCurrentTmuxSession() (*Session, error) {
-	focusWid, focusTabs, focusSessions, err := a.getFocusInfo()
+	return a.GetCurrentTmuxSessionContext(context.Background())
+}
+
+// GetCurrentTmuxSessionContext is like GetCurrentTmuxSession but takes a context
+func (a *App) GetCurrentTmuxSessionContext(ctx context.Context) (*Session, error) {
+	focusWid, focusTabs, focusSessions, err := a.getFocusInfo(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// only the sessions of tmux integration tabs have a tmuxWindowPane, skip the others without asking
+	inTmux := func(_ *WindowInfo, t *TabInfo, _ *SessionInfo) bool { return t.TmuxConnectionID != "" }
 	pid := os.Getpid()
 	var tmuxSessions []*Session
-	session, err := findSessionByMatch(a, func(wid, tid, sid string) bool {
-		session := newSession(a, wid, tid, sid)
-		values, err := session.GetVariable("jobPid", "tmuxWindowPane")
+	for session, err := range a.SessionsContext(ctx, inTmux) {
+		if err != nil {
+			return nil, err
+		}
+		values, err := session.GetVariableContext(ctx, "jobPid", "tmuxWindowPane")
 		if err != nil || len(values) != 2 || values[1] == "null" {
-			return false
+			continue
 		}
 		if _, err := strconv.ParseUint(values[1], 10, 32); err != nil {
-			return false
+			continue
 		}
 		if jobPid, err := strconv.ParseUint(values[0], 10, 32); err != nil || pid != int(jobPid) {
-			return false
+			continue
+		}
+		if session.wid == focusWid && slices.Contains(focusTabs, session.tid) && slices.Contains(focusSessions, session.sid) {
+			return session, nil
 		}
 		tmuxSessions = append(tmuxSessions, session)
-		return wid == focusWid && slices.Contains(focusTabs, tid) && slices.Contains(focusSessions, sid)
-	})
-	if err != nil {
-		return nil, err
 	}
 
-	if session != nil {
-		return session, nil
-	}
 	for _, tmuxSession := range tmuxSessions {
 		if slices.Contains(focusSessions, tmuxSession.GetSessionID()) {
 			return tmuxSession, nil
@@ -0,0 +1,129 @@
+package iterm2_test
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/iterm2test"
+)
+
+// newTestServer starts a fake iTerm2 stopped at the end of the test
+func newTestServer(t *testing.T) *iterm2test.Server {
+	t.Helper()
+	srv, err := iterm2test.NewServer()
+	if err != nil {
+		t.Fatalf("start server failed: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	return srv
+}
+
+// newTestApp connects an App to srv, closed at the end of the test
+func newTestApp(t *testing.T, srv *iterm2test.Server) *iterm2.App {
+	t.Helper()
+	app, err := srv.NewApp("test")
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = app.Close() })
+	return app
+}
+
+// receive returns the next value of ch, failing the test if none comes in time
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a value")
+	}
+	var zero T
+	return zero
+}
+
+// nothing fails the test if ch receives a value soon
+func nothing[T any](t *testing.T, ch <-chan T) {
+	t.Helper()
+	select {
+	case v := <-ch:
+		t.Fatalf("unexpected value: %v", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// waitClosed drains ch, failing the test if it is not closed in time
+func waitClosed[T any](t *testing.T, ch <-chan T) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for the channel to be closed")
+		}
+	}
+}
+
+func TestCreateWindow(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	w, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	windows, err := app.ListWindows()
+	if err != nil {
+		t.Fatalf("list windows failed: %v", err)
+	}
+	if len(windows) != 1 || windows[0].GetWindowID() != w.GetWindowID() {
+		t.Fatalf("windows = %v, want [%v]", windows, w.GetWindowID())
+	}
+	active, err := app.GetCurrentActiveSession()
+	if err != nil {
+		t.Fatalf("get active session failed: %v", err)
+	}
+	if active.GetSessionID() != s.GetSessionID() {
+		t.Fatalf("active session = %v, want %v", active.GetSessionID(), s.GetSessionID())
+	}
+}
+
+func TestGetCurrentTmuxSession(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	pid := strconv.Itoa(os.Getpid())
+	_, _, plain := srv.CreateWindow()
+	_, tid, tmux := srv.CreateWindow()
+	srv.SetTmux(tid, "1", "@1", plain)
+	for _, sid := range []string{plain, tmux} {
+		srv.SetVariable(sid, "jobPid", pid)
+		srv.SetVariable(sid, "tmuxWindowPane", "1")
+	}
+	var variableRequests atomic.Int32
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetVariableRequest() != nil {
+			variableRequests.Add(1)
+		}
+		return nil
+	})
+
+	session, err := app.GetCurrentTmuxSession()
+	if err != nil {
+		t.Fatalf("get tmux session failed: %v", err)
+	}
+	if session.GetSessionID() != tmux {
+		t.Fatalf("tmux session = %s, want %s", session.GetSessionID(), tmux)
+	}
+	if n := variableRequests.Load(); n != 1 {
+		t.Fatalf("%d variable_request sent, want one for the only tmux integration session", n)
+	}
+}
@@ -2,20 +2,15 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
-	"math/rand"
-	"net"
-	"net/http"
-	"os"
-	"path/filepath"
+	"log/slog"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/andybrewer/mack"
-	"github.com/gorilla/websocket"
 	"github.com/trzsz/iterm2/api"
 	"google.golang.org/protobuf/proto"
 )
@@ -25,167 +20,522 @@ import (
 // parameter is optional. If provided, it will bypass script authentication
 // prompts.
 func New(appName string) (*Client, error) {
-	// ITERM2_COOKIE is an an environment variable that's set on each terminal
-	// session. But it only seems to work the first time, then it gets
-	// invalidated. Therefore, we keep trying until it returns an error, then we
-	// try to generate a new cookie instead. See
-	// https://github.com/marwan-at-work/iterm2/issues/4
-	if cookie := os.Getenv("ITERM2_COOKIE"); cookie != "" {
-		client, err := newClient(appName, cookie)
-		if err == nil {
-			return client, nil
-		}
+	return NewWithOptions(appName, Options{})
+}
+
+// NewWithOptions is like New but configures the client with opts
+func NewWithOptions(appName string, opts Options) (*Client, error) {
+	c := &Client{
+		appName: appName,
+		opts:    opts,
+		log:     opts.logger(),
+		rpcs:    make(map[int64]chan<- *api.ServerOriginatedMessage),
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}),
+		subs:    make(map[string]*subscriptionGroup),
+		tools:   make(map[string]*api.RegisterToolRequest),
 	}
-	client, err := newClient(appName, "")
-	if err != nil && strings.Contains(err.Error(), "The Python API is not enabled") {
-		return nil, fmt.Errorf("the Python API is not enabled")
+	c.ncond = sync.NewCond(&c.nmu)
+	c.invoke = chainInterceptors(c.call, opts.Interceptors)
+	cn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	// cn must be current before its workers start, for connectionLost to shut
+	// the client down if the connection breaks right away
+	if !c.resume(cn) {
+		cn.fail(ErrClosed)
+		return nil, cn.err
 	}
-	return client, err
+	go cn.readWorker()
+	go cn.keepalive()
+	go c.notifyWorker()
+	return c, nil
 }
 
-func newClient(appName, cookie string) (*Client, error) {
-	h := http.Header{}
-	h.Set("origin", "ws://localhost/")
-	h.Set("x-iterm2-library-version", "go 3.6")
-	h.Set("x-iterm2-disable-auth-ui", "true")
-	if cookie == "" {
-		resp, err := mack.Tell("iTerm2", fmt.Sprintf("request cookie and key for app named %q", appName))
+// dial opens a new connection to iTerm2. Unless Options.NewTransport is set, it
+// tries the credential providers in order until iTerm2 accepts a connection.
+// A provider that caches credentials is asked once more after iTerm2 refused its credentials.
+// Dialing stops at once when iTerm2 cannot be reached, e.g. while it is not running.
+func (c *Client) dial() (*conn, error) {
+	if c.opts.NewTransport != nil {
+		t, err := c.opts.NewTransport()
 		if err != nil {
-			return nil, fmt.Errorf("AppleScript/tell: %w", err)
+			return nil, err
 		}
-		fields := strings.Fields(resp)
-		if len(fields) != 2 {
-			return nil, fmt.Errorf("incorrect field format: %q", resp)
-		}
-		cookie = fields[0]
-		h.Set("x-iterm2-key", fields[1])
+		return c.newConn(t), nil
 	}
-	h.Set("x-iterm2-cookie", cookie)
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("os.UserHomeDir: %w", err)
+	providers := c.opts.Credentials
+	if providers == nil {
+		providers = DefaultCredentials()
 	}
-	d := &websocket.Dialer{
-		NetDial: func(network, addr string) (net.Conn, error) {
-			return net.Dial("unix", filepath.Join(homeDir, "/Library/Application Support/iTerm2/private/socket"))
-		},
-		HandshakeTimeout: 45 * time.Second,
-		Subprotocols:     []string{"api.iterm2.com"},
-	}
-	c, resp, err := d.Dial("ws://localhost", h)
-	if err != nil && resp != nil {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("error connecting to iTerm2: %v - body: %s", err, b)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("error connecting to iTerm2: %v", err)
+	err := ErrNoCredentials
+	for _, provider := range providers {
+		for range 2 {
+			var creds *Credentials
+			creds, err = provider.Credentials(c.appName)
+			if err != nil {
+				break
+			}
+			var t *wsTransport
+			t, err = dialWebsocket(&c.opts, creds)
+			if err == nil {
+				return c.newConn(t), nil
+			}
+			if !errors.Is(err, errRejected) {
+				// iTerm2 could not be reached: the credentials may still be good,
+				// and asking the other providers would be pointless
+				return nil, dialError(err)
+			}
+			inv, ok := provider.(CredentialInvalidator)
+			if !ok || inv.Invalidate(c.appName) != nil {
+				break
+			}
+		}
 	}
-	cl := &Client{
-		c:       c,
-		rpcs:    make(map[int64]chan<- *api.ServerOriginatedMessage),
-		writeCh: make(chan writeReq),
+	return nil, dialError(err)
+}
+
+// dialError simplifies the error of an iTerm2 that does not accept API connections at all
+func dialError(err error) error {
+	if strings.Contains(err.Error(), "The Python API is not enabled") {
+		return fmt.Errorf("the Python API is not enabled")
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	cl.cancel = cancel
-	go cl.readWorker(ctx)
-	go cl.writeWorker()
-	return cl, nil
+	return err
 }
 
+// ErrClosed is returned by calls made after the client has been closed
+var ErrClosed = errors.New("client closed")
+
+// ErrConnectionLost is returned to every pending and future call once the
+// websocket connection to iTerm2 is broken
+var ErrConnectionLost = errors.New("connection to iTerm2 lost")
+
 // Client wraps a websocket client connection to iTerm2.
 // Must be instantiated with NewClient.
 type Client struct {
-	c       *websocket.Conn
+	appName string
+	opts    Options
+	log     *slog.Logger
+	invoke  Invoker
 	rpcs    map[int64]chan<- *api.ServerOriginatedMessage
+	gaveUp  [64]int64
+	nGaveUp int
 	mu      sync.Mutex
-	cancel  context.CancelFunc
-	writeCh chan writeReq
-	cmu     sync.RWMutex
+	cn      *conn
+	ready   chan struct{}
+	done    chan struct{}
+	drain   chan struct{}
+	pending int
+	err     error
 	closed  atomic.Bool
+	hmu     sync.Mutex
+	onLost  []func(error)
+	onBack  []func()
+	submu   sync.Mutex
+	smu     sync.Mutex
+	subs    map[string]*subscriptionGroup
+	tools   map[string]*api.RegisterToolRequest
+	nmu     sync.Mutex
+	ncond   *sync.Cond
+	nqueue  []*api.Notification
+	lastID  atomic.Int64
+	pong    atomic.Int64
+	stats   struct {
+		calls, late, orphaned, reused, invalid atomic.Int64
+	}
 }
 
-type writeReq struct {
-	msg  []byte
-	resp chan error
+// Stats are counters of the traffic of a Client, to diagnose protocol desyncs
+type Stats struct {
+	// Calls is the number of requests sent to iTerm2
+	Calls int64
+
+	// LateResponses is the number of responses arriving after their call gave up,
+	// e.g. because its context was cancelled
+	LateResponses int64
+
+	// OrphanedResponses is the number of responses matching no call, e.g. because
+	// iTerm2 answered a request twice or with an unknown id
+	OrphanedResponses int64
+
+	// ReusedIDs is the number of requests refused because their id was still pending
+	ReusedIDs int64
+
+	// InvalidMessages is the number of messages from iTerm2 that could not be decoded
+	InvalidMessages int64
 }
 
-func (c *Client) writeWorker() {
-	for req := range c.writeCh {
-		err := c.c.WriteMessage(websocket.BinaryMessage, req.msg)
-		req.resp <- err
+// Stats returns the counters of the client since it was created
+func (c *Client) Stats() Stats {
+	return Stats{
+		Calls:             c.stats.calls.Load(),
+		LateResponses:     c.stats.late.Load(),
+		OrphanedResponses: c.stats.orphaned.Load(),
+		ReusedIDs:         c.stats.reused.Load(),
+		InvalidMessages:   c.stats.invalid.Load(),
 	}
 }
 
-func (c *Client) readWorker(ctx context.Context) {
+// conn is a single websocket connection to iTerm2. A reconnecting client
+// replaces its conn every time the connection is re-established.
+type conn struct {
+	c       *Client
+	t       Transport
+	version string
+	wmu     sync.Mutex
+	done    chan struct{}
+	err     error
+}
+
+func (c *Client) newConn(t Transport) *conn {
+	var version string
+	if ws, ok := t.(*wsTransport); ok {
+		version = ws.version
+	}
+	if c.opts.Recorder != nil {
+		t = &recordingTransport{Transport: t, r: c.opts.Recorder}
+	}
+	if p, ok := pinger(t); ok && c.opts.KeepaliveInterval > 0 {
+		p.OnPong(func() { c.pong.Store(time.Now().UnixNano()) })
+	}
+	return &conn{c: c, t: t, version: version, done: make(chan struct{})}
+}
+
+func (cn *conn) write(msg []byte) error {
+	cn.wmu.Lock()
+	defer cn.wmu.Unlock()
+	return cn.t.WriteMessage(msg)
+}
+
+// fail marks the connection as broken, waking up every call waiting on it
+func (cn *conn) fail(err error) bool {
+	cn.c.mu.Lock()
+	defer cn.c.mu.Unlock()
+	select {
+	case <-cn.done:
+		return false
+	default:
+	}
+	cn.err = err
+	close(cn.done)
+	_ = cn.t.Close()
+	return true
+}
+
+func (cn *conn) readWorker() {
 	for {
-		_, msg, err := c.c.ReadMessage()
-		if ctx.Err() != nil {
-			return
-		}
+		msg, err := cn.t.ReadMessage()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			continue
+			cn.c.connectionLost(cn, err)
+			return
 		}
 		var resp api.ServerOriginatedMessage
 		err = proto.Unmarshal(msg, &resp)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			cn.c.stats.invalid.Add(1)
+			cn.c.log.Warn("iterm2: invalid message", "error", err)
 			continue
 		}
+		if n := resp.GetNotification(); n != nil {
+			cn.c.log.Debug("iterm2: notification", "type", submessageName(n))
+			cn.c.queueNotification(n)
+			continue
+		}
+		cn.c.mu.Lock()
+		ch, ok := cn.c.rpcs[resp.GetId()]
+		delete(cn.c.rpcs, resp.GetId())
+		late := !ok && cn.c.forgetGaveUp(resp.GetId())
+		cn.c.mu.Unlock()
+		switch {
+		case late:
+			cn.c.stats.late.Add(1)
+			cn.c.log.Debug("iterm2: response after its call gave up", "type", submessageName(&resp), "id", resp.GetId())
+		case !ok:
+			cn.c.stats.orphaned.Add(1)
+			cn.c.log.Warn("iterm2: response without pending call", "type", submessageName(&resp), "id", resp.GetId())
+		default:
+			ch <- &resp
+		}
+	}
+}
+
+// currentConn returns the current connection, waiting while the client reconnects
+func (c *Client) currentConn(ctx context.Context) (*conn, error) {
+	for {
 		c.mu.Lock()
-		ch, ok := c.rpcs[resp.GetId()]
-		delete(c.rpcs, resp.GetId())
+		cn, ready, err := c.cn, c.ready, c.err
 		c.mu.Unlock()
-		if !ok {
-			fmt.Fprintf(os.Stderr, "could not find call for %d: %v\n", resp.GetId(), &resp)
-			continue
+		if err != nil {
+			return nil, err
+		}
+		if cn != nil {
+			return cn, nil
 		}
-		ch <- &resp
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.done:
+		}
+	}
+}
+
+// ProtocolVersion returns the API protocol version announced by iTerm2 when
+// connecting, e.g. "1.10", or "" if it is unknown or the client is offline
+func (c *Client) ProtocolVersion() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cn == nil {
+		return ""
+	}
+	return c.cn.version
+}
+
+// OnDisconnect registers fn to be called when the connection to iTerm2 is lost
+// unexpectedly. The error passed to fn wraps ErrConnectionLost and the cause.
+// It is not called when the client is closed by Close. A reconnecting client
+// calls fn each time the connection is lost, before it starts to reconnect.
+func (c *Client) OnDisconnect(fn func(error)) {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+	c.onLost = append(c.onLost, fn)
+}
+
+// OnReconnect registers fn to be called after a reconnecting client has
+// re-established the connection and replayed its subscriptions
+func (c *Client) OnReconnect(fn func()) {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+	c.onBack = append(c.onBack, fn)
+}
+
+func (c *Client) connectionLost(cn *conn, cause error) {
+	err := fmt.Errorf("%w: %v", ErrConnectionLost, cause)
+	if !cn.fail(err) || c.closed.Load() {
+		return
+	}
+	c.log.Warn("iterm2: connection lost", "error", cause)
+	c.mu.Lock()
+	current := c.cn == cn
+	if current && c.opts.Reconnect {
+		c.cn = nil
+		c.ready = make(chan struct{})
+	}
+	c.mu.Unlock()
+	if !current {
+		return
+	}
+	if c.opts.Reconnect {
+		go c.reconnect()
+	} else if !c.shutdown(err) {
+		return
+	}
+	c.hmu.Lock()
+	handlers := slices.Clone(c.onLost)
+	c.hmu.Unlock()
+	for _, fn := range handlers {
+		fn(err)
 	}
 }
 
+// shutdown marks the client as closed and wakes up every goroutine waiting on it.
+// It reports whether this call was the one that closed the client.
+func (c *Client) shutdown(err error) bool {
+	if !c.closed.CompareAndSwap(false, true) {
+		return false
+	}
+	c.mu.Lock()
+	c.err = err
+	cn := c.cn
+	close(c.done)
+	c.mu.Unlock()
+	if cn != nil {
+		cn.fail(err)
+	}
+	c.nmu.Lock()
+	c.ncond.Broadcast()
+	c.nmu.Unlock()
+	c.cancelSubscriptions()
+	return true
+}
+
 // Call sends a request to the iTerm2 server
 func (c *Client) Call(req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
-	c.cmu.RLock()
-	defer c.cmu.RUnlock()
-	if c.closed.Load() {
-		return nil, fmt.Errorf("client closed")
+	return c.CallContext(context.Background(), req)
+}
+
+// CallContext sends a request to the iTerm2 server and waits for its response
+// until the context is done. A cancelled call stops waiting for its response.
+// While a reconnecting client is offline, calls wait for the new connection.
+func (c *Client) CallContext(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+	return c.invoke(ctx, req)
+}
+
+// call is the Invoker wrapped by the interceptors
+func (c *Client) call(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.drain != nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: shutting down", ErrClosed)
 	}
-	req.Id = id(rand.Int63())
+	c.pending++
+	c.mu.Unlock()
+	defer c.callDone()
+
+	cn, err := c.currentConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cn.call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if tool := req.GetRegisterToolRequest(); tool != nil &&
+		resp.GetRegisterToolResponse().GetStatus() == api.RegisterToolResponse_OK {
+		c.smu.Lock()
+		c.tools[tool.GetIdentifier()] = tool
+		c.smu.Unlock()
+	}
+	return resp, nil
+}
+
+func (cn *conn) call(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+	req.Id = id(cn.c.lastID.Add(1))
+	if !cn.c.log.Enabled(ctx, slog.LevelDebug) {
+		return cn.roundTrip(ctx, req)
+	}
+	start := time.Now()
+	resp, err := cn.roundTrip(ctx, req)
+	attrs := []any{"type", submessageName(req), "id", req.GetId(), "latency", time.Since(start)}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	cn.c.log.DebugContext(ctx, "iterm2: call", attrs...)
+	return resp, err
+}
+
+// roundTrip writes req and waits for the response with the same id
+func (cn *conn) roundTrip(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+	c := cn.c
 	ch := make(chan *api.ServerOriginatedMessage, 1)
 	c.mu.Lock()
+	if _, ok := c.rpcs[req.GetId()]; ok {
+		c.mu.Unlock()
+		c.stats.reused.Add(1)
+		return nil, fmt.Errorf("request id %d is already pending", req.GetId())
+	}
 	c.rpcs[req.GetId()] = ch
 	c.mu.Unlock()
+	c.stats.calls.Add(1)
+	cancel := func() {
+		c.mu.Lock()
+		delete(c.rpcs, req.GetId())
+		c.mu.Unlock()
+	}
 	msg, err := proto.Marshal(req)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	wr := writeReq{msg: msg, resp: make(chan error, 1)}
-	c.writeCh <- wr
-	err = <-wr.resp
-	if err != nil {
+	if err := cn.write(msg); err != nil {
+		cancel()
+		select {
+		case <-cn.done:
+			return nil, cn.err
+		default:
+		}
 		return nil, fmt.Errorf("error writing to websocket: %w", err)
 	}
-	resp := <-ch
+	var resp *api.ServerOriginatedMessage
+	select {
+	case resp = <-ch:
+	case <-ctx.Done():
+		c.mu.Lock()
+		if _, ok := c.rpcs[req.GetId()]; ok {
+			delete(c.rpcs, req.GetId())
+			c.gaveUp[c.nGaveUp%len(c.gaveUp)] = req.GetId()
+			c.nGaveUp++
+		}
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	case <-cn.done:
+		select {
+		case resp = <-ch:
+		default:
+			cancel()
+			return nil, cn.err
+		}
+	}
 	if resp.GetError() != "" {
 		return nil, fmt.Errorf("error from server: %v", resp.GetError())
 	}
 	return resp, nil
 }
 
-// Close closes the websocket connection and frees any goroutine resources
-func (c *Client) Close() error {
-	c.cmu.Lock()
-	defer c.cmu.Unlock()
-	if !c.closed.CompareAndSwap(false, true) {
-		return fmt.Errorf("already closed")
+// forgetGaveUp reports whether id is one of the last calls that gave up waiting
+// for their response, and forgets it. c.mu must be held.
+func (c *Client) forgetGaveUp(id int64) bool {
+	if i := slices.Index(c.gaveUp[:], id); i >= 0 && id != 0 {
+		c.gaveUp[i] = 0
+		return true
 	}
-	close(c.writeCh)
-	c.cancel()
-	return c.c.Close()
+	return false
 }
 
-// IsClosed reports whether the client connection has been closed
+// callDone marks a call as finished, waking up Shutdown after the last one
+func (c *Client) callDone() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending--
+	if c.pending == 0 && c.drain != nil {
+		select {
+		case <-c.drain:
+		default:
+			close(c.drain)
+		}
+	}
+}
+
+// Shutdown closes the client gracefully: new calls fail with ErrClosed at once,
+// while the calls in flight may complete until ctx is done. The calls still
+// waiting for their response then fail with an error wrapping ErrClosed, and
+// Shutdown returns the error of ctx. Closing a closed client does nothing.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	if c.drain == nil {
+		c.drain = make(chan struct{})
+		if c.pending == 0 {
+			close(c.drain)
+		}
+	}
+	drain := c.drain
+	c.mu.Unlock()
+
+	select {
+	case <-drain:
+		c.shutdown(ErrClosed)
+		return nil
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		c.shutdown(fmt.Errorf("%w: shutdown before the response arrived", ErrClosed))
+		return ctx.Err()
+	}
+}
+
+// Close closes the websocket connection at once, failing the calls in flight
+// with ErrClosed, and frees any goroutine resources. Closing a closed client does nothing.
+func (c *Client) Close() error {
+	c.shutdown(ErrClosed)
+	return nil
+}
+
+// IsClosed reports whether the client connection has been closed, either by
+// Close or because the connection to iTerm2 was lost and was not re-established
 func (c *Client) IsClosed() bool {
 	return c.closed.Load()
 }
@@ -193,3 +543,15 @@ func (c *Client) IsClosed() bool {
 func id(i int64) *int64 {
 	return &i
 }
+
+// submessageName returns the name of the field set in the oneof of a message, e.g. list_sessions_request
+func submessageName(m proto.Message) string {
+	rm := m.ProtoReflect()
+	oneofs := rm.Descriptor().Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		if fd := rm.WhichOneof(oneofs.Get(i)); fd != nil {
+			return string(fd.Name())
+		}
+	}
+	return "empty message"
+}
@@ -0,0 +1,201 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+	"github.com/trzsz/iterm2/iterm2test"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestServer starts a fake iTerm2 stopped at the end of the test
+func newTestServer(t *testing.T) *iterm2test.Server {
+	t.Helper()
+	srv, err := iterm2test.NewServer()
+	if err != nil {
+		t.Fatalf("start server failed: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	return srv
+}
+
+// newTestClient connects a Client to srv with the options changed by configure, if any
+func newTestClient(t *testing.T, srv *iterm2test.Server, configure func(*client.Options)) *client.Client {
+	t.Helper()
+	opts := srv.Options()
+	if configure != nil {
+		configure(&opts)
+	}
+	c, err := client.NewWithOptions("test", opts)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func listSessions(ctx context.Context, c *client.Client) error {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{ListSessionsRequest: &api.ListSessionsRequest{}},
+	})
+	if err == nil && resp.GetListSessionsResponse() == nil {
+		return errors.New("list_sessions_response is nil")
+	}
+	return err
+}
+
+// blockListSessions makes srv hold the next list_sessions_request until the returned function is called
+func blockListSessions(srv *iterm2test.Server) (release func()) {
+	ch := make(chan struct{})
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetListSessionsRequest() != nil {
+			srv.Handle(nil)
+			<-ch
+		}
+		return nil
+	})
+	return func() { close(ch) }
+}
+
+func TestCall(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, nil)
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if stats := c.Stats(); stats.Calls != 1 || stats.OrphanedResponses != 0 || stats.ReusedIDs != 0 {
+		t.Fatalf("stats = %+v, want one call", stats)
+	}
+}
+
+func TestCallCancelled(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := listSessions(ctx, c); !errors.Is(err, context.Canceled) {
+		t.Fatalf("call error = %v, want %v", err, context.Canceled)
+	}
+
+	release := blockListSessions(srv)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := listSessions(ctx, c); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// the late response of the cancelled call must not be taken for the response of the next one
+	release()
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call after a cancelled call failed: %v", err)
+	}
+	if c.IsClosed() {
+		t.Fatal("a cancelled call should not close the client")
+	}
+	if stats := c.Stats(); stats.LateResponses == 0 || stats.OrphanedResponses != 0 {
+		t.Fatalf("stats = %+v, want late responses only", stats)
+	}
+}
+
+func TestDuplicateResponse(t *testing.T) {
+	listReq := func(id int64) *client.Record {
+		return &client.Record{Request: &api.ClientOriginatedMessage{
+			Id:         proto.Int64(id),
+			Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{ListSessionsRequest: &api.ListSessionsRequest{}},
+		}}
+	}
+	listResp := func(id int64) *client.Record {
+		return &client.Record{Response: &api.ServerOriginatedMessage{
+			Id:         proto.Int64(id),
+			Submessage: &api.ServerOriginatedMessage_ListSessionsResponse{ListSessionsResponse: &api.ListSessionsResponse{}},
+		}}
+	}
+	records := []*client.Record{listReq(1), listResp(1), listResp(1), listReq(2), listResp(2)}
+	c, err := client.NewWithOptions("test", client.Options{
+		NewTransport: func() (client.Transport, error) { return client.NewReplayTransport(records), nil },
+	})
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	for range 2 {
+		if err := listSessions(context.Background(), c); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+	}
+	if stats := c.Stats(); stats.OrphanedResponses != 1 || stats.LateResponses != 0 {
+		t.Fatalf("stats = %+v, want one orphaned response", stats)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, nil)
+	lost := make(chan error, 1)
+	c.OnDisconnect(func(err error) { lost <- err })
+
+	release := blockListSessions(srv)
+	defer release()
+	errc := make(chan error, 1)
+	go func() { errc <- listSessions(context.Background(), c) }()
+	time.Sleep(20 * time.Millisecond)
+	srv.DropConnections()
+
+	if err := receiveErr(t, errc); !errors.Is(err, client.ErrConnectionLost) {
+		t.Fatalf("call in flight error = %v, want %v", err, client.ErrConnectionLost)
+	}
+	if err := receiveErr(t, lost); !errors.Is(err, client.ErrConnectionLost) {
+		t.Fatalf("disconnect error = %v, want %v", err, client.ErrConnectionLost)
+	}
+	if !c.IsClosed() {
+		t.Fatal("client should be closed after the connection is lost")
+	}
+	if err := listSessions(context.Background(), c); !errors.Is(err, client.ErrConnectionLost) {
+		t.Fatalf("call after loss error = %v, want %v", err, client.ErrConnectionLost)
+	}
+}
+
+func TestCloseIsNotDisconnect(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, nil)
+	lost := make(chan error, 1)
+	c.OnDisconnect(func(err error) { lost <- err })
+
+	_ = c.Close()
+	if err := listSessions(context.Background(), c); !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("call after close error = %v, want %v", err, client.ErrClosed)
+	}
+	select {
+	case err := <-lost:
+		t.Fatalf("OnDisconnect called by Close: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// receiveErr returns the next error of ch, failing the test if none comes in time
+func receiveErr(t *testing.T, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for an error")
+		return nil
+	}
+}
+
+// eventually fails the test if cond does not become true in time
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the condition")
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/andybrewer/mack"
+)
+
+// ErrNoCredentials is returned by a CredentialProvider that has nothing to offer
+var ErrNoCredentials = errors.New("no credentials available")
+
+// Credentials authenticate a connection to the iTerm2 API
+type Credentials struct {
+	Cookie string
+	Key    string
+}
+
+// CredentialProvider supplies the credentials used to connect to iTerm2
+type CredentialProvider interface {
+	Credentials(appName string) (*Credentials, error)
+}
+
+// CredentialInvalidator is implemented by providers that cache credentials.
+// Invalidate is called when iTerm2 refused the credentials returned last time,
+// after which the provider is asked once more for fresh ones.
+type CredentialInvalidator interface {
+	Invalidate(appName string) error
+}
+
+// DefaultCredentials returns the providers used when Options.Credentials is nil:
+// the environment first, then AppleScript.
+func DefaultCredentials() []CredentialProvider {
+	return []CredentialProvider{EnvCredentials{}, AppleScriptCredentials{}}
+}
+
+// StaticCredentials always returns the same credentials
+type StaticCredentials Credentials
+
+// Credentials implements CredentialProvider
+func (s StaticCredentials) Credentials(string) (*Credentials, error) {
+	creds := Credentials(s)
+	return &creds, nil
+}
+
+// EnvCredentials reads the ITERM2_COOKIE and ITERM2_KEY environment variables,
+// which iTerm2 sets for the scripts it launches.
+type EnvCredentials struct{}
+
+// Credentials implements CredentialProvider
+func (EnvCredentials) Credentials(string) (*Credentials, error) {
+	// ITERM2_COOKIE is an an environment variable that's set on each terminal
+	// session. But it only seems to work the first time, then it gets
+	// invalidated. Therefore, we keep trying until it returns an error, then we
+	// try to generate a new cookie instead. See
+	// https://github.com/marwan-at-work/iterm2/issues/4
+	cookie := os.Getenv("ITERM2_COOKIE")
+	if cookie == "" {
+		return nil, fmt.Errorf("ITERM2_COOKIE is not set: %w", ErrNoCredentials)
+	}
+	return &Credentials{Cookie: cookie, Key: os.Getenv("ITERM2_KEY")}, nil
+}
+
+// AppleScriptCredentials asks iTerm2 for a new cookie and key through AppleScript.
+// This may show a permission prompt the first time an app name is used.
+type AppleScriptCredentials struct{}
+
+// Credentials implements CredentialProvider
+func (AppleScriptCredentials) Credentials(appName string) (*Credentials, error) {
+	resp, err := mack.Tell("iTerm2", fmt.Sprintf("request cookie and key for app named %q", appName))
+	if err != nil {
+		return nil, fmt.Errorf("AppleScript/tell: %w", err)
+	}
+	fields := strings.Fields(resp)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("incorrect field format: %q", resp)
+	}
+	return &Credentials{Cookie: fields[0], Key: fields[1]}, nil
+}
+
+// FileCacheCredentials keeps the credentials fetched from Provider in a file readable only by the
+// current user, and reuses them until they expire or iTerm2 refuses them. This saves short-lived
+// programs an osascript round-trip on every run. A cache file that cannot be written is not an
+// error: the fresh credentials are still returned, and fetched again next time.
+type FileCacheCredentials struct {
+	// Provider supplies the credentials when the cache is empty or stale.
+	// Defaults to AppleScriptCredentials.
+	Provider CredentialProvider
+
+	// Path of the cache file. Defaults to a file named after the app in the user cache directory.
+	Path string
+
+	// MaxAge is how long cached credentials are reused. Zero means until iTerm2 refuses them.
+	MaxAge time.Duration
+}
+
+type cachedCredentials struct {
+	App     string    `json:"app"`
+	Cookie  string    `json:"cookie"`
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+}
+
+// Credentials implements CredentialProvider
+func (f *FileCacheCredentials) Credentials(appName string) (*Credentials, error) {
+	path, err := f.path(appName)
+	if err != nil {
+		return nil, err
+	}
+	if creds := f.load(path, appName); creds != nil {
+		return creds, nil
+	}
+
+	provider := f.Provider
+	if provider == nil {
+		provider = AppleScriptCredentials{}
+	}
+	creds, err := provider.Credentials(appName)
+	if err != nil {
+		return nil, err
+	}
+	_ = f.store(path, appName, creds)
+	return creds, nil
+}
+
+// Invalidate implements CredentialInvalidator by removing the cache file
+func (f *FileCacheCredentials) Invalidate(appName string) error {
+	path, err := f.path(appName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove credentials cache failed: %w", err)
+	}
+	return nil
+}
+
+func (f *FileCacheCredentials) path(appName string) (string, error) {
+	if f.Path != "" {
+		return f.Path, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir: %w", err)
+	}
+	return filepath.Join(cacheDir, "iterm2", url.PathEscape(appName)+".json"), nil
+}
+
+func (f *FileCacheCredentials) load(path, appName string) *Credentials {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm()&0o077 != 0 {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cached cachedCredentials
+	if err := json.Unmarshal(b, &cached); err != nil {
+		return nil
+	}
+	if cached.App != appName || cached.Cookie == "" {
+		return nil
+	}
+	if f.MaxAge > 0 && time.Since(cached.Created) > f.MaxAge {
+		return nil
+	}
+	return &Credentials{Cookie: cached.Cookie, Key: cached.Key}
+}
+
+func (f *FileCacheCredentials) store(path, appName string, creds *Credentials) error {
+	b, err := json.Marshal(&cachedCredentials{
+		App:     appName,
+		Cookie:  creds.Cookie,
+		Key:     creds.Key,
+		Created: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create credentials cache directory failed: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".credentials-*")
+	if err != nil {
+		return fmt.Errorf("create credentials cache failed: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write credentials cache failed: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write credentials cache failed: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename credentials cache failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package client_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2/client"
+	"github.com/trzsz/iterm2/iterm2test"
+)
+
+// cachingProvider returns its cookie until it is invalidated, then fresh
+type cachingProvider struct {
+	cookie, fresh string
+	asked         int
+	invalidated   int
+}
+
+func (p *cachingProvider) Credentials(string) (*client.Credentials, error) {
+	p.asked++
+	return &client.Credentials{Cookie: p.cookie}, nil
+}
+
+func (p *cachingProvider) Invalidate(string) error {
+	p.invalidated++
+	p.cookie = p.fresh
+	return nil
+}
+
+func TestCredentialsInvalidatedWhenRejected(t *testing.T) {
+	srv := newTestServer(t)
+	p := &cachingProvider{cookie: "stale", fresh: iterm2test.Cookie}
+	c, err := client.NewWithOptions("test", client.Options{
+		SocketPath:  srv.SocketPath(),
+		Credentials: []client.CredentialProvider{p},
+	})
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	_ = c.Close()
+	if p.asked != 2 || p.invalidated != 1 {
+		t.Fatalf("asked %d times and invalidated %d times, want 2 and 1", p.asked, p.invalidated)
+	}
+}
+
+func TestCredentialsKeptWhenUnreachable(t *testing.T) {
+	p := &cachingProvider{cookie: iterm2test.Cookie}
+	next := &cachingProvider{cookie: iterm2test.Cookie}
+	_, err := client.NewWithOptions("test", client.Options{
+		SocketPath:  filepath.Join(t.TempDir(), "socket"),
+		Credentials: []client.CredentialProvider{p, next},
+	})
+	if err == nil {
+		t.Fatal("connecting to a missing socket should fail")
+	}
+	if p.asked != 1 || p.invalidated != 0 || next.asked != 0 {
+		t.Fatalf("asked %d times and invalidated %d times, then the next provider %d times, want 1, 0 and 0",
+			p.asked, p.invalidated, next.asked)
+	}
+}
+
+// newFileCache returns a FileCacheCredentials in a temporary directory, backed by a cachingProvider
+func newFileCache(t *testing.T) (*client.FileCacheCredentials, *cachingProvider) {
+	t.Helper()
+	p := &cachingProvider{cookie: "cookie"}
+	return &client.FileCacheCredentials{Provider: p, Path: filepath.Join(t.TempDir(), "iterm2", "test.json")}, p
+}
+
+// cachedCookie asks f for the credentials of app, failing the test on an error
+func cachedCookie(t *testing.T, f *client.FileCacheCredentials, app string) string {
+	t.Helper()
+	creds, err := f.Credentials(app)
+	if err != nil {
+		t.Fatalf("credentials failed: %v", err)
+	}
+	return creds.Cookie
+}
+
+func TestFileCacheCredentials(t *testing.T) {
+	f, p := newFileCache(t)
+	for range 2 {
+		if cookie := cachedCookie(t, f, "test"); cookie != "cookie" {
+			t.Fatalf("cookie = %q, want %q", cookie, "cookie")
+		}
+	}
+	if p.asked != 1 {
+		t.Fatalf("provider asked %d times, want once", p.asked)
+	}
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		t.Fatalf("stat cache failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("cache mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// another app does not get the credentials of this one
+	cachedCookie(t, f, "other")
+	if p.asked != 2 {
+		t.Fatalf("provider asked %d times, want again for another app", p.asked)
+	}
+
+	if err := f.Invalidate("other"); err != nil {
+		t.Fatalf("invalidate failed: %v", err)
+	}
+	if _, err := os.Stat(f.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("cache still there after invalidate: %v", err)
+	}
+	if err := f.Invalidate("other"); err != nil {
+		t.Fatalf("invalidate without cache failed: %v", err)
+	}
+}
+
+func TestFileCacheCredentialsIgnoresLoosePermissions(t *testing.T) {
+	f, p := newFileCache(t)
+	cachedCookie(t, f, "test")
+	if err := os.Chmod(f.Path, 0o644); err != nil {
+		t.Fatalf("chmod failed: %v", err)
+	}
+	cachedCookie(t, f, "test")
+	if p.asked != 2 {
+		t.Fatalf("provider asked %d times, want again when others can read the cache", p.asked)
+	}
+}
+
+func TestFileCacheCredentialsMaxAge(t *testing.T) {
+	f, p := newFileCache(t)
+	f.MaxAge = time.Minute
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	old := fmt.Sprintf(`{"app":"test","cookie":"old","key":"","created":%q}`, time.Now().Add(-time.Hour).Format(time.RFC3339))
+	if err := os.WriteFile(f.Path, []byte(old), 0o600); err != nil {
+		t.Fatalf("write cache failed: %v", err)
+	}
+	if cookie := cachedCookie(t, f, "test"); cookie != "cookie" || p.asked != 1 {
+		t.Fatalf("cookie = %q after asking %d times, want fresh credentials", cookie, p.asked)
+	}
+
+	f.MaxAge = 0
+	if err := os.WriteFile(f.Path, []byte(old), 0o600); err != nil {
+		t.Fatalf("write cache failed: %v", err)
+	}
+	if cookie := cachedCookie(t, f, "test"); cookie != "old" {
+		t.Fatalf("cookie = %q, want the cached one without MaxAge", cookie)
+	}
+}
+
+func TestFileCacheCredentialsUnwritable(t *testing.T) {
+	f, p := newFileCache(t)
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatalf("write file failed: %v", err)
+	}
+	f.Path = filepath.Join(blocker, "test.json")
+	if cookie := cachedCookie(t, f, "test"); cookie != "cookie" || p.asked != 1 {
+		t.Fatalf("cookie = %q after asking %d times, want the fresh credentials", cookie, p.asked)
+	}
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Errors matching the non-OK statuses of the iTerm2 responses with errors.Is.
+// Every status meaning that an object does not exist (anymore) also matches
+// ErrNotFound, and every status rejecting the request itself matches ErrMalformed.
+var (
+	// ErrNotFound matches every status meaning that the target does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrMalformed matches every status meaning that the request is invalid
+	ErrMalformed = errors.New("request malformed")
+
+	// ErrSessionNotFound matches SESSION_NOT_FOUND and INVALID_SESSION
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrWindowNotFound matches WINDOW_NOT_FOUND and INVALID_WINDOW_ID
+	ErrWindowNotFound = errors.New("window not found")
+
+	// ErrTabNotFound matches TAB_NOT_FOUND, INVALID_TAB_ID and BAD_TAB_ID
+	ErrTabNotFound = errors.New("tab not found")
+
+	// ErrInvalidID matches INVALID_ID, INVALID_IDENTIFIER, BAD_IDENTIFIER and INVALID_CONNECTION_ID
+	ErrInvalidID = errors.New("invalid id")
+
+	// ErrInvalidAssignment matches INVALID_ASSIGNMENT
+	ErrInvalidAssignment = errors.New("invalid assignment")
+
+	// ErrTimeout matches TIMEOUT
+	ErrTimeout = errors.New("timeout")
+
+	// ErrFailed matches FAILED and ERROR
+	ErrFailed = errors.New("failed")
+
+	// ErrDeferred matches DEFERRED: the change will be applied later
+	ErrDeferred = errors.New("deferred")
+
+	// ErrImpossible matches IMPOSSIBLE
+	ErrImpossible = errors.New("impossible")
+
+	// ErrUserDeclined matches USER_DECLINED
+	ErrUserDeclined = errors.New("user declined")
+
+	// ErrPermissionDenied matches PERMISSION_DENIED
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrDisabled matches DISABLED
+	ErrDisabled = errors.New("disabled")
+
+	// ErrCannotSplit matches CANNOT_SPLIT
+	ErrCannotSplit = errors.New("cannot split")
+
+	// ErrSessionNotRestartable matches SESSION_NOT_RESTARTABLE
+	ErrSessionNotRestartable = errors.New("session not restartable")
+
+	// ErrPromptUnavailable matches PROMPT_UNAVAILABLE
+	ErrPromptUnavailable = errors.New("prompt unavailable")
+
+	// ErrAlreadySubscribed matches ALREADY_SUBSCRIBED
+	ErrAlreadySubscribed = errors.New("already subscribed")
+
+	// ErrNotSubscribed matches NOT_SUBSCRIBED
+	ErrNotSubscribed = errors.New("not subscribed")
+
+	// ErrAlreadyInTransaction matches ALREADY_IN_TRANSACTION
+	ErrAlreadyInTransaction = errors.New("already in transaction")
+
+	// ErrNoTransaction matches NO_TRANSACTION
+	ErrNoTransaction = errors.New("no transaction")
+
+	// ErrDuplicateRPC matches DUPLICATE_SERVER_ORIGINATED_RPC
+	ErrDuplicateRPC = errors.New("duplicate server originated rpc")
+)
+
+// statusErrors maps a status name to its error and to the broader ErrNotFound or ErrMalformed.
+// INVALID_TARGET does not say whether the window or the session is missing, so only the
+// property methods of package iterm2, which know it, make it match ErrWindowNotFound or ErrSessionNotFound.
+var statusErrors = map[string][2]error{
+	"SESSION_NOT_FOUND":                 {ErrSessionNotFound, ErrNotFound},
+	"INVALID_SESSION":                   {ErrSessionNotFound, ErrNotFound},
+	"WINDOW_NOT_FOUND":                  {ErrWindowNotFound, ErrNotFound},
+	"INVALID_WINDOW_ID":                 {ErrWindowNotFound, ErrNotFound},
+	"TAB_NOT_FOUND":                     {ErrTabNotFound, ErrNotFound},
+	"INVALID_TAB_ID":                    {ErrTabNotFound, ErrNotFound},
+	"BAD_TAB_ID":                        {ErrTabNotFound, ErrNotFound},
+	"NOT_FOUND":                         {ErrNotFound, nil},
+	"ARRANGEMENT_NOT_FOUND":             {ErrNotFound, nil},
+	"PRESET_NOT_FOUND":                  {ErrNotFound, nil},
+	"INVALID_PROFILE_NAME":              {ErrNotFound, nil},
+	"BAD_GUID":                          {ErrNotFound, nil},
+	"INVALID_TARGET":                    {ErrNotFound, nil},
+	"BAD_JSON":                          {ErrMalformed, nil},
+	"INVALID_ID":                        {ErrInvalidID, ErrMalformed},
+	"INVALID_IDENTIFIER":                {ErrInvalidID, ErrMalformed},
+	"BAD_IDENTIFIER":                    {ErrInvalidID, ErrMalformed},
+	"INVALID_CONNECTION_ID":             {ErrInvalidID, ErrMalformed},
+	"INVALID_ASSIGNMENT":                {ErrInvalidAssignment, ErrMalformed},
+	"REQUEST_MALFORMED":                 {ErrMalformed, nil},
+	"INVALID_REQUEST":                   {ErrMalformed, nil},
+	"INVALID_VALUE":                     {ErrMalformed, nil},
+	"INVALID_RANGE":                     {ErrMalformed, nil},
+	"INVALID_LINE_RANGE":                {ErrMalformed, nil},
+	"INVALID_OPTION":                    {ErrMalformed, nil},
+	"INVALID_NAME":                      {ErrMalformed, nil},
+	"INVALID_SIZE":                      {ErrMalformed, nil},
+	"INVALID_TAB_INDEX":                 {ErrMalformed, nil},
+	"UNRECOGNIZED_NAME":                 {ErrMalformed, nil},
+	"MISSING_SCOPE":                     {ErrMalformed, nil},
+	"MISSING_SUBSTITUTION":              {ErrMalformed, nil},
+	"MALFORMED_CUSTOM_PROFILE_PROPERTY": {ErrMalformed, nil},
+	"MULTI_GET_DISALLOWED":              {ErrMalformed, nil},
+	"WRONG_TREE":                        {ErrMalformed, nil},
+	"BROADCAST_DOMAINS_NOT_DISJOINT":    {ErrMalformed, nil},
+	"SESSIONS_NOT_IN_SAME_WINDOW":       {ErrMalformed, nil},
+	"TIMEOUT":                           {ErrTimeout, nil},
+	"FAILED":                            {ErrFailed, nil},
+	"ERROR":                             {ErrFailed, nil},
+	"DEFERRED":                          {ErrDeferred, nil},
+	"IMPOSSIBLE":                        {ErrImpossible, nil},
+	"USER_DECLINED":                     {ErrUserDeclined, nil},
+	"PERMISSION_DENIED":                 {ErrPermissionDenied, nil},
+	"DISABLED":                          {ErrDisabled, nil},
+	"CANNOT_SPLIT":                      {ErrCannotSplit, nil},
+	"SESSION_NOT_RESTARTABLE":           {ErrSessionNotRestartable, nil},
+	"PROMPT_UNAVAILABLE":                {ErrPromptUnavailable, nil},
+	"ALREADY_SUBSCRIBED":                {ErrAlreadySubscribed, nil},
+	"NOT_SUBSCRIBED":                    {ErrNotSubscribed, nil},
+	"ALREADY_IN_TRANSACTION":            {ErrAlreadyInTransaction, nil},
+	"NO_TRANSACTION":                    {ErrNoTransaction, nil},
+	"DUPLICATE_SERVER_ORIGINATED_RPC":   {ErrDuplicateRPC, nil},
+}
+
+// StatusError is returned when iTerm2 answers a request with a status other than OK.
+// It matches the Err variables of this package with errors.Is, and keeps the raw status,
+// e.g. an api.SplitPaneResponse_Status, for errors.As.
+type StatusError struct {
+	// Response is the name of the response message, e.g. split_pane_response
+	Response string
+
+	// Status is the status enum value of the response
+	Status protoreflect.Enum
+
+	// Reason is the explanation given by iTerm2, if any
+	Reason string
+}
+
+// Name returns the name of the status, e.g. SESSION_NOT_FOUND
+func (e *StatusError) Name() string {
+	if v := e.Status.Descriptor().Values().ByNumber(e.Status.Number()); v != nil {
+		return string(v.Name())
+	}
+	return fmt.Sprint(e.Status.Number())
+}
+
+func (e *StatusError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s status is not ok: %s: %s", e.Response, e.Name(), e.Reason)
+	}
+	return fmt.Sprintf("%s status is not ok: %s", e.Response, e.Name())
+}
+
+// Unwrap returns the errors matching the status
+func (e *StatusError) Unwrap() []error {
+	var errs []error
+	for _, err := range statusErrors[e.Name()] {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,30 @@
+package client_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+)
+
+func TestStatusError(t *testing.T) {
+	for _, tt := range []struct {
+		err  *client.StatusError
+		want []error
+	}{
+		{&client.StatusError{Status: api.SplitPaneResponse_SESSION_NOT_FOUND}, []error{client.ErrSessionNotFound, client.ErrNotFound}},
+		{&client.StatusError{Status: api.GetPropertyResponse_INVALID_TARGET}, []error{client.ErrNotFound}},
+		{&client.StatusError{Status: api.PreferencesResponse_Result_SetPreferenceResult_BAD_JSON}, []error{client.ErrMalformed}},
+		{&client.StatusError{Status: api.SetPropertyResponse_FAILED}, []error{client.ErrFailed}},
+	} {
+		for _, want := range tt.want {
+			if !errors.Is(tt.err, want) {
+				t.Errorf("%s does not match %v", tt.err.Name(), want)
+			}
+		}
+		if errors.Is(tt.err, client.ErrWindowNotFound) {
+			t.Errorf("%s matches %v", tt.err.Name(), client.ErrWindowNotFound)
+		}
+	}
+}
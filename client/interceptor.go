@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/trzsz/iterm2/api"
+)
+
+// Invoker sends a request to iTerm2 and waits for its response
+type Invoker func(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error)
+
+// Interceptor runs around every call made with Call or CallContext. It must call
+// next to send the request, and may inspect or change the request, the response
+// and the error, e.g. to collect metrics or to start tracing spans.
+type Interceptor func(ctx context.Context, req *api.ClientOriginatedMessage, next Invoker) (*api.ServerOriginatedMessage, error)
+
+// chainInterceptors wraps invoke with the interceptors, the first one being the outermost
+func chainInterceptors(invoke Invoker, interceptors []Interceptor) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return invoke
+}
+
+// CallStats are the statistics of the calls of one request type
+type CallStats struct {
+	Count        int64
+	Errors       int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+// AverageLatency returns the mean latency of the calls
+func (s CallStats) AverageLatency() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Count)
+}
+
+// StatsCollector counts calls and their latency by request type, e.g. list_sessions_request.
+// Add its Intercept method to Options.Interceptors.
+type StatsCollector struct {
+	mu    sync.Mutex
+	stats map[string]*CallStats
+}
+
+// NewStatsCollector returns an empty StatsCollector
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{stats: make(map[string]*CallStats)}
+}
+
+// Intercept is an Interceptor recording every call
+func (s *StatsCollector) Intercept(ctx context.Context, req *api.ClientOriginatedMessage, next Invoker) (*api.ServerOriginatedMessage, error) {
+	start := time.Now()
+	resp, err := next(ctx, req)
+	latency := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := submessageName(req)
+	st := s.stats[name]
+	if st == nil {
+		st = &CallStats{}
+		s.stats[name] = st
+	}
+	st.Count++
+	if err != nil {
+		st.Errors++
+	}
+	st.TotalLatency += latency
+	st.MaxLatency = max(st.MaxLatency, latency)
+	return resp, err
+}
+
+// Snapshot returns a copy of the statistics by request type
+func (s *StatsCollector) Snapshot() map[string]CallStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := make(map[string]CallStats, len(s.stats))
+	for name, st := range s.stats {
+		snapshot[name] = *st
+	}
+	return snapshot
+}
+
+// Reset clears the statistics
+func (s *StatsCollector) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.stats)
+}
+
+// SlowCallLogger returns an Interceptor logging a warning for every call taking at least threshold
+func SlowCallLogger(logger *slog.Logger, threshold time.Duration) Interceptor {
+	return func(ctx context.Context, req *api.ClientOriginatedMessage, next Invoker) (*api.ServerOriginatedMessage, error) {
+		start := time.Now()
+		resp, err := next(ctx, req)
+		if latency := time.Since(start); latency >= threshold {
+			attrs := []any{"type", submessageName(req), "id", req.GetId(), "latency", latency}
+			if err != nil {
+				attrs = append(attrs, "error", err)
+			}
+			logger.WarnContext(ctx, "iterm2: slow call", attrs...)
+		}
+		return resp, err
+	}
+}
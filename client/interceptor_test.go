@@ -0,0 +1,120 @@
+package client_test
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+)
+
+func TestInterceptorOrder(t *testing.T) {
+	srv := newTestServer(t)
+	var trace []string
+	tracing := func(name string) client.Interceptor {
+		return func(ctx context.Context, req *api.ClientOriginatedMessage, next client.Invoker) (*api.ServerOriginatedMessage, error) {
+			trace = append(trace, name+" in")
+			defer func() { trace = append(trace, name+" out") }()
+			return next(ctx, req)
+		}
+	}
+	c := newTestClient(t, srv, func(opts *client.Options) {
+		opts.Interceptors = []client.Interceptor{tracing("outer"), tracing("inner")}
+	})
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if want := []string{"outer in", "inner in", "inner out", "outer out"}; !slices.Equal(trace, want) {
+		t.Fatalf("trace = %v, want %v", trace, want)
+	}
+}
+
+func TestInterceptorChangesCall(t *testing.T) {
+	srv := newTestServer(t)
+	createTab := func(ctx context.Context, req *api.ClientOriginatedMessage, next client.Invoker) (*api.ServerOriginatedMessage, error) {
+		req.Submessage = &api.ClientOriginatedMessage_CreateTabRequest{CreateTabRequest: &api.CreateTabRequest{}}
+		return next(ctx, req)
+	}
+	c := newTestClient(t, srv, func(opts *client.Options) { opts.Interceptors = []client.Interceptor{createTab} })
+
+	resp, err := c.Call(&api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{ListSessionsRequest: &api.ListSessionsRequest{}},
+	})
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if resp.GetCreateTabResponse().GetStatus() != api.CreateTabResponse_OK {
+		t.Fatalf("response = %v, want the create_tab_response of the rewritten request", resp)
+	}
+	if windows := srv.ListSessions().GetWindows(); len(windows) != 1 {
+		t.Fatalf("windows = %v, want the one created by the rewritten request", windows)
+	}
+}
+
+func TestStatsCollector(t *testing.T) {
+	srv := newTestServer(t)
+	stats := client.NewStatsCollector()
+	c := newTestClient(t, srv, func(opts *client.Options) { opts.Interceptors = []client.Interceptor{stats.Intercept} })
+
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	release := blockListSessions(srv)
+	time.AfterFunc(30*time.Millisecond, release)
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("slow call failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := listSessions(ctx, c); err == nil {
+		t.Fatal("cancelled call succeeded")
+	}
+	if _, err := c.Call(&api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{CreateTabRequest: &api.CreateTabRequest{}},
+	}); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	snapshot := stats.Snapshot()
+	ls := snapshot["list_sessions_request"]
+	if ls.Count != 3 || ls.Errors != 1 || ls.MaxLatency < 30*time.Millisecond || ls.AverageLatency() > ls.MaxLatency {
+		t.Fatalf("list_sessions_request stats = %+v, want 3 calls, 1 error and a slow one", ls)
+	}
+	if ct := snapshot["create_tab_request"]; ct.Count != 1 || ct.Errors != 0 {
+		t.Fatalf("create_tab_request stats = %+v, want 1 call", ct)
+	}
+	stats.Reset()
+	if snapshot := stats.Snapshot(); len(snapshot) != 0 {
+		t.Fatalf("stats after reset = %v, want none", snapshot)
+	}
+}
+
+func TestSlowCallLogger(t *testing.T) {
+	srv := newTestServer(t)
+	h := &captureHandler{level: slog.LevelDebug}
+	c := newTestClient(t, srv, func(opts *client.Options) {
+		opts.Interceptors = []client.Interceptor{client.SlowCallLogger(slog.New(h), 30*time.Millisecond)}
+	})
+
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if n := h.len(); n != 0 {
+		t.Fatalf("%d records logged for a fast call, want none", n)
+	}
+	release := blockListSessions(srv)
+	time.AfterFunc(30*time.Millisecond, release)
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("slow call failed: %v", err)
+	}
+	attrs, ok := h.find(slog.LevelWarn, "iterm2: slow call")
+	if !ok || h.len() != 1 {
+		t.Fatalf("%d records logged, want one slow call warning", h.len())
+	}
+	if attrs["type"].String() != "list_sessions_request" || attrs["latency"].Duration() < 30*time.Millisecond {
+		t.Fatalf("slow call attributes = %v, want its type and latency", attrs)
+	}
+}
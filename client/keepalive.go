@@ -0,0 +1,77 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// keepalive pings iTerm2 every Options.KeepaliveInterval until cn fails, and
+// tears cn down like a read error when a pong does not arrive in time
+func (cn *conn) keepalive() {
+	c := cn.c
+	p, ok := pinger(cn.t)
+	if !ok || c.opts.KeepaliveInterval <= 0 {
+		return
+	}
+	timeout := c.opts.keepaliveTimeout()
+	ticker := time.NewTicker(c.opts.KeepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-cn.done:
+			return
+		}
+		sent := time.Now()
+		if err := p.Ping(sent.Add(timeout)); err != nil {
+			c.connectionLost(cn, fmt.Errorf("ping failed: %w", err))
+			return
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case <-timer.C:
+		case <-cn.done:
+			timer.Stop()
+			return
+		}
+		if c.LastPong().Before(sent) {
+			c.connectionLost(cn, fmt.Errorf("no pong within %v", timeout))
+			return
+		}
+	}
+}
+
+// pinger returns the Pinger of t, looking through a recordingTransport
+func pinger(t Transport) (Pinger, bool) {
+	if rt, ok := t.(*recordingTransport); ok {
+		t = rt.Transport
+	}
+	p, ok := t.(Pinger)
+	return p, ok
+}
+
+// LastPong returns when the last pong was received, or the zero time if none was.
+// Pongs are only requested when Options.KeepaliveInterval is set.
+func (c *Client) LastPong() time.Time {
+	if ns := c.pong.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// Healthy reports whether the client is connected to iTerm2. With the keepalive
+// enabled, a connection whose pong is late is torn down and no longer healthy.
+func (c *Client) Healthy() bool {
+	c.mu.Lock()
+	cn := c.cn
+	c.mu.Unlock()
+	if cn == nil || c.closed.Load() {
+		return false
+	}
+	select {
+	case <-cn.done:
+		return false
+	default:
+		return true
+	}
+}
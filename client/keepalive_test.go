@@ -0,0 +1,96 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2/client"
+)
+
+func TestKeepalive(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, func(opts *client.Options) { opts.KeepaliveInterval = 10 * time.Millisecond })
+
+	var first time.Time
+	eventually(t, func() bool {
+		first = c.LastPong()
+		return !first.IsZero()
+	})
+	eventually(t, func() bool { return c.LastPong().After(first) })
+	if !c.Healthy() {
+		t.Fatal("client answering pings should be healthy")
+	}
+}
+
+// deafTransport is a pushTransport that never gets a pong
+type deafTransport struct {
+	*pushTransport
+}
+
+func (deafTransport) Ping(time.Time) error { return nil }
+func (deafTransport) OnPong(func())        {}
+
+func TestKeepaliveMissedPong(t *testing.T) {
+	c, err := client.NewWithOptions("test", client.Options{
+		KeepaliveInterval: 10 * time.Millisecond,
+		NewTransport:      func() (client.Transport, error) { return deafTransport{newPushTransport()}, nil },
+	})
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	lost := make(chan error, 1)
+	c.OnDisconnect(func(err error) { lost <- err })
+
+	errc := make(chan error, 1)
+	go func() { errc <- listSessions(context.Background(), c) }()
+	if err := receiveErr(t, errc); !errors.Is(err, client.ErrConnectionLost) {
+		t.Fatalf("call in flight error = %v, want %v", err, client.ErrConnectionLost)
+	}
+	if err := receiveErr(t, lost); !errors.Is(err, client.ErrConnectionLost) || !strings.Contains(err.Error(), "no pong") {
+		t.Fatalf("disconnect error = %v, want a missed pong", err)
+	}
+	if c.Healthy() {
+		t.Fatal("client without pong should not be healthy")
+	}
+	if err := listSessions(context.Background(), c); !errors.Is(err, client.ErrConnectionLost) {
+		t.Fatalf("call after loss error = %v, want %v", err, client.ErrConnectionLost)
+	}
+}
+
+func TestKeepaliveMissedPongReconnects(t *testing.T) {
+	var dials atomic.Int32
+	opts := client.Options{
+		KeepaliveInterval: 10 * time.Millisecond,
+		NewTransport: func() (client.Transport, error) {
+			dials.Add(1)
+			return deafTransport{newPushTransport()}, nil
+		},
+	}
+	reconnecting(&opts)
+	c, err := client.NewWithOptions("test", opts)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	back := make(chan struct{}, 1)
+	c.OnReconnect(func() {
+		select {
+		case back <- struct{}{}:
+		default:
+		}
+	})
+
+	select {
+	case <-back:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the client to reconnect")
+	}
+	if n := dials.Load(); n < 2 {
+		t.Fatalf("dialed %d times, want a redial after the missed pong", n)
+	}
+}
@@ -0,0 +1,21 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler is a slog.Handler dropping every record, used when Options.Logger is nil
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+func (o *Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return slog.New(discardHandler{})
+}
@@ -0,0 +1,156 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+	"google.golang.org/protobuf/proto"
+)
+
+// captureHandler is a slog.Handler keeping every record at or above its level
+type captureHandler struct {
+	level   slog.Level
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *captureHandler) Enabled(_ context.Context, level slog.Level) bool { return level >= h.level }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *captureHandler) WithGroup(string) slog.Handler      { return h }
+
+// find returns the attributes of the first record with the given level and message
+func (h *captureHandler) find(level slog.Level, msg string) (map[string]slog.Value, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Level == level && r.Message == msg {
+			attrs := make(map[string]slog.Value)
+			r.Attrs(func(a slog.Attr) bool {
+				attrs[a.Key] = a.Value
+				return true
+			})
+			return attrs, true
+		}
+	}
+	return nil, false
+}
+
+func (h *captureHandler) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.records)
+}
+
+// pushTransport is a Transport reading the messages pushed to it and dropping the ones written
+type pushTransport struct {
+	msgs chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+func newPushTransport() *pushTransport {
+	return &pushTransport{msgs: make(chan []byte, 8), done: make(chan struct{})}
+}
+
+func (t *pushTransport) ReadMessage() ([]byte, error) {
+	select {
+	case msg := <-t.msgs:
+		return msg, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *pushTransport) WriteMessage([]byte) error { return nil }
+
+func (t *pushTransport) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+// pushBadMessages sends an undecodable message and a response to no call through a pushTransport,
+// and waits until c has read them
+func pushBadMessages(t *testing.T, logger *slog.Logger) *client.Client {
+	t.Helper()
+	tr := newPushTransport()
+	c, err := client.NewWithOptions("test", client.Options{
+		Logger:       logger,
+		NewTransport: func() (client.Transport, error) { return tr, nil },
+	})
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	orphan, err := proto.Marshal(&api.ServerOriginatedMessage{
+		Id:         proto.Int64(42),
+		Submessage: &api.ServerOriginatedMessage_ListSessionsResponse{ListSessionsResponse: &api.ListSessionsResponse{}},
+	})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	tr.msgs <- []byte{0xff, 0xff}
+	tr.msgs <- orphan
+	eventually(t, func() bool {
+		stats := c.Stats()
+		return stats.InvalidMessages == 1 && stats.OrphanedResponses == 1
+	})
+	return c
+}
+
+func TestLogWarnings(t *testing.T) {
+	h := &captureHandler{level: slog.LevelWarn}
+	pushBadMessages(t, slog.New(h))
+	if _, ok := h.find(slog.LevelWarn, "iterm2: invalid message"); !ok {
+		t.Error("no warning for the invalid message")
+	}
+	attrs, ok := h.find(slog.LevelWarn, "iterm2: response without pending call")
+	if !ok || attrs["id"].Int64() != 42 || attrs["type"].String() != "list_sessions_response" {
+		t.Errorf("orphaned response warning = %v, %v, want its type and id", attrs, ok)
+	}
+}
+
+func TestNoLogger(t *testing.T) {
+	h := &captureHandler{level: slog.LevelDebug}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(h))
+	defer slog.SetDefault(defaultLogger)
+
+	pushBadMessages(t, nil)
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, nil)
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if n := h.len(); n != 0 {
+		t.Fatalf("%d records logged without a Logger, want none", n)
+	}
+}
+
+func TestLogCalls(t *testing.T) {
+	h := &captureHandler{level: slog.LevelDebug}
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, func(opts *client.Options) { opts.Logger = slog.New(h) })
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	attrs, ok := h.find(slog.LevelDebug, "iterm2: call")
+	if !ok {
+		t.Fatal("call not logged")
+	}
+	if attrs["type"].String() != "list_sessions_request" || attrs["id"].Int64() == 0 || attrs["latency"].Kind() != slog.KindDuration {
+		t.Fatalf("call attributes = %v, want its type, id and latency", attrs)
+	}
+}
@@ -0,0 +1,338 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// NotificationHandler receives the notifications delivered to a subscription
+type NotificationHandler func(*api.Notification)
+
+// Subscription is a registered interest in a kind of iTerm2 notification.
+// Call Unsubscribe when the notifications are no longer needed.
+type Subscription struct {
+	c        *Client
+	key      string
+	handler  NotificationHandler
+	onCancel func()
+	once     sync.Once
+}
+
+// subscriptionGroup shares one server side subscription between all the
+// handlers registered with an identical NotificationRequest, since iTerm2
+// refuses to subscribe twice to the same notification.
+type subscriptionGroup struct {
+	req  *api.NotificationRequest
+	subs []*Subscription
+}
+
+// Subscribe sends a NotificationRequest to iTerm2 and registers handler to be
+// called for every matching notification. Handlers are called sequentially on
+// a dedicated goroutine, so they may call back into the client.
+func (c *Client) Subscribe(req *api.NotificationRequest, handler NotificationHandler) (*Subscription, error) {
+	return c.SubscribeContext(context.Background(), req, handler)
+}
+
+// SubscribeContext is like Subscribe but takes a context for the NotificationRequest
+func (c *Client) SubscribeContext(ctx context.Context, req *api.NotificationRequest, handler NotificationHandler) (*Subscription, error) {
+	return c.subscribe(ctx, req, handler, nil)
+}
+
+func (c *Client) subscribe(ctx context.Context, req *api.NotificationRequest, handler NotificationHandler, onCancel func()) (*Subscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("notification handler is nil")
+	}
+	req = proto.Clone(req).(*api.NotificationRequest)
+	req.Subscribe = proto.Bool(true)
+	key, err := subscriptionKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.submu.Lock()
+	defer c.submu.Unlock()
+	c.smu.Lock()
+	g := c.subs[key]
+	c.smu.Unlock()
+	if g == nil {
+		if err := c.sendNotificationRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		g = &subscriptionGroup{req: req}
+	}
+	s := &Subscription{c: c, key: key, handler: handler, onCancel: onCancel}
+	c.smu.Lock()
+	g.subs = append(g.subs, s)
+	c.subs[key] = g
+	c.smu.Unlock()
+	return s, nil
+}
+
+// SubscribeChan is like Subscribe but delivers the notifications to the returned
+// channel, which is closed once the subscription is cancelled or the client is closed.
+// Delivery blocks while the channel is full, so keep receiving until it is closed.
+func (c *Client) SubscribeChan(req *api.NotificationRequest, size int) (<-chan *api.Notification, *Subscription, error) {
+	return c.SubscribeChanContext(context.Background(), req, size)
+}
+
+// SubscribeChanContext is like SubscribeChan but takes a context for the NotificationRequest
+func (c *Client) SubscribeChanContext(ctx context.Context, req *api.NotificationRequest, size int) (<-chan *api.Notification, *Subscription, error) {
+	ch := make(chan *api.Notification, size)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	closed := false
+	s, err := c.subscribe(ctx, req, func(n *api.Notification) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- n:
+		case <-done:
+		}
+	}, func() {
+		close(done)
+		mu.Lock()
+		defer mu.Unlock()
+		closed = true
+		close(ch)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, s, nil
+}
+
+// Unsubscribe stops the delivery of notifications to this subscription. The
+// server side subscription is cancelled when its last handler unsubscribes.
+func (s *Subscription) Unsubscribe() error {
+	return s.UnsubscribeContext(context.Background())
+}
+
+// UnsubscribeContext is like Unsubscribe but takes a context for the NotificationRequest
+func (s *Subscription) UnsubscribeContext(ctx context.Context) error {
+	var err error
+	s.once.Do(func() {
+		err = s.c.unsubscribe(ctx, s)
+		if s.onCancel != nil {
+			s.onCancel()
+		}
+	})
+	return err
+}
+
+func (c *Client) unsubscribe(ctx context.Context, s *Subscription) error {
+	c.submu.Lock()
+	defer c.submu.Unlock()
+	c.smu.Lock()
+	g := c.subs[s.key]
+	if g == nil {
+		c.smu.Unlock()
+		return nil
+	}
+	g.subs = slices.DeleteFunc(g.subs, func(sub *Subscription) bool { return sub == s })
+	if len(g.subs) > 0 {
+		c.smu.Unlock()
+		return nil
+	}
+	delete(c.subs, s.key)
+	c.smu.Unlock()
+	if c.closed.Load() {
+		return nil
+	}
+	req := proto.Clone(g.req).(*api.NotificationRequest)
+	req.Subscribe = proto.Bool(false)
+	return c.sendNotificationRequest(ctx, req)
+}
+
+func (c *Client) sendNotificationRequest(ctx context.Context, req *api.NotificationRequest) error {
+	resp, err := c.CallContext(ctx, newNotificationMessage(req))
+	if err != nil {
+		return fmt.Errorf("call notification_request failed: %w", err)
+	}
+	return checkNotificationResponse(resp)
+}
+
+func newNotificationMessage(req *api.NotificationRequest) *api.ClientOriginatedMessage {
+	return &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_NotificationRequest{
+			NotificationRequest: req,
+		},
+	}
+}
+
+func checkNotificationResponse(resp *api.ServerOriginatedMessage) error {
+	nResp := resp.GetNotificationResponse()
+	if nResp == nil {
+		return fmt.Errorf("notification_response is nil")
+	}
+	if nResp.GetStatus() != api.NotificationResponse_OK {
+		return &StatusError{Response: "notification_response", Status: nResp.GetStatus()}
+	}
+	return nil
+}
+
+// cancelSubscriptions drops every subscription without talking to iTerm2,
+// closing the channels handed out by SubscribeChan.
+func (c *Client) cancelSubscriptions() {
+	c.dropSubscriptions(func(*api.NotificationRequest) bool { return true })
+}
+
+// dropSubscriptions is like cancelSubscriptions for the subscriptions whose request matches
+func (c *Client) dropSubscriptions(match func(req *api.NotificationRequest) bool) {
+	c.smu.Lock()
+	var subs []*Subscription
+	for key, g := range c.subs {
+		if match(g.req) {
+			subs = append(subs, g.subs...)
+			delete(c.subs, key)
+		}
+	}
+	c.smu.Unlock()
+	for _, s := range subs {
+		s.once.Do(func() {
+			if s.onCancel != nil {
+				s.onCancel()
+			}
+		})
+	}
+}
+
+func subscriptionKey(req *api.NotificationRequest) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("marshal notification_request failed: %w", err)
+	}
+	return string(b), nil
+}
+
+func (c *Client) queueNotification(n *api.Notification) {
+	c.nmu.Lock()
+	c.nqueue = append(c.nqueue, n)
+	c.nmu.Unlock()
+	c.ncond.Signal()
+}
+
+func (c *Client) notifyWorker() {
+	for {
+		c.nmu.Lock()
+		for len(c.nqueue) == 0 && !c.closed.Load() {
+			c.ncond.Wait()
+		}
+		if len(c.nqueue) == 0 {
+			c.nmu.Unlock()
+			return
+		}
+		n := c.nqueue[0]
+		c.nqueue[0] = nil
+		c.nqueue = c.nqueue[1:]
+		c.nmu.Unlock()
+		c.dispatchNotification(n)
+	}
+}
+
+func (c *Client) dispatchNotification(n *api.Notification) {
+	var handlers []NotificationHandler
+	c.smu.Lock()
+	for _, g := range c.subs {
+		if !matchNotification(g.req, n) {
+			continue
+		}
+		for _, s := range g.subs {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	c.smu.Unlock()
+	for _, handler := range handlers {
+		handler(n)
+	}
+	if ts := n.GetTerminateSessionNotification(); ts != nil {
+		// iTerm2 forgets the subscriptions of a terminated session, and would refuse to replay them
+		sid := ts.GetSessionId()
+		c.dropSubscriptions(func(req *api.NotificationRequest) bool { return subscriptionSession(req) == sid })
+	}
+}
+
+// subscriptionSession returns the session a subscription is restricted to, if any
+func subscriptionSession(req *api.NotificationRequest) string {
+	if vm := req.GetVariableMonitorRequest(); vm != nil {
+		if vm.GetScope() == api.VariableScope_SESSION && vm.GetIdentifier() != "all" {
+			return vm.GetIdentifier()
+		}
+		return ""
+	}
+	switch sid := req.GetSession(); sid {
+	case "all", "active":
+		return ""
+	default:
+		return sid
+	}
+}
+
+// matchNotification reports whether the notification n was requested by req
+func matchNotification(req *api.NotificationRequest, n *api.Notification) bool {
+	matchSession := func(session string) bool {
+		switch req.GetSession() {
+		case "", "all", "active":
+			return true
+		}
+		return req.GetSession() == session
+	}
+
+	switch req.GetNotificationType() {
+	case api.NotificationType_NOTIFY_ON_KEYSTROKE, api.NotificationType_KEYSTROKE_FILTER:
+		if k := n.GetKeystrokeNotification(); k != nil {
+			return matchSession(k.GetSession())
+		}
+	case api.NotificationType_NOTIFY_ON_SCREEN_UPDATE:
+		if su := n.GetScreenUpdateNotification(); su != nil {
+			return matchSession(su.GetSession())
+		}
+	case api.NotificationType_NOTIFY_ON_PROMPT:
+		if p := n.GetPromptNotification(); p != nil {
+			return matchSession(p.GetSession())
+		}
+	case api.NotificationType_NOTIFY_ON_LOCATION_CHANGE:
+		if lc := n.GetLocationChangeNotification(); lc != nil {
+			return matchSession(lc.GetSession())
+		}
+	case api.NotificationType_NOTIFY_ON_CUSTOM_ESCAPE_SEQUENCE:
+		if ce := n.GetCustomEscapeSequenceNotification(); ce != nil {
+			return matchSession(ce.GetSession())
+		}
+	case api.NotificationType_NOTIFY_ON_NEW_SESSION:
+		return n.GetNewSessionNotification() != nil
+	case api.NotificationType_NOTIFY_ON_TERMINATE_SESSION:
+		return n.GetTerminateSessionNotification() != nil
+	case api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE:
+		return n.GetLayoutChangedNotification() != nil
+	case api.NotificationType_NOTIFY_ON_FOCUS_CHANGE:
+		return n.GetFocusChangedNotification() != nil
+	case api.NotificationType_NOTIFY_ON_BROADCAST_CHANGE:
+		return n.GetBroadcastDomainsChanged() != nil
+	case api.NotificationType_NOTIFY_ON_SERVER_ORIGINATED_RPC:
+		if rpc := n.GetServerOriginatedRpcNotification(); rpc != nil {
+			return rpc.GetRpc().GetName() == req.GetRpcRegistrationRequest().GetName()
+		}
+	case api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE:
+		if vc := n.GetVariableChangedNotification(); vc != nil {
+			vm := req.GetVariableMonitorRequest()
+			if vc.GetScope() != vm.GetScope() || vc.GetName() != vm.GetName() {
+				return false
+			}
+			return vm.GetIdentifier() == "" || vm.GetIdentifier() == "all" || vm.GetIdentifier() == vc.GetIdentifier()
+		}
+	case api.NotificationType_NOTIFY_ON_PROFILE_CHANGE:
+		if pc := n.GetProfileChangedNotification(); pc != nil {
+			guid := req.GetProfileChangeRequest().GetGuid()
+			return guid == "" || guid == pc.GetGuid()
+		}
+	}
+	return false
+}
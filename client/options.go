@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// Options configures how a Client connects to iTerm2
+type Options struct {
+	// SocketPath is the unix socket iTerm2 listens on. If empty, the ITERM2_SOCKET
+	// environment variable is used, then DefaultSocketPath in the home directory.
+	// ITERM2_SOCKET may also hold a ws://host:port URL.
+	SocketPath string
+
+	// URL connects over TCP instead of the unix socket, e.g. ws://localhost:1912
+	// for the legacy TCP port of iTerm2. It takes precedence over SocketPath.
+	URL string
+
+	// Dial opens the network connection to iTerm2, e.g. through an SSH tunnel.
+	// It is called with "unix" and the socket path, or "tcp" and the host:port of URL.
+	// Defaults to the DialContext method of a zero net.Dialer.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Credentials are tried in order until iTerm2 accepts one of them.
+	// Defaults to DefaultCredentials: the environment first, then AppleScript.
+	Credentials []CredentialProvider
+
+	// NewTransport replaces the connection to iTerm2 altogether, e.g. with a replay transport.
+	// When set, the socket, URL, Dial and Credentials options are ignored.
+	NewTransport func() (Transport, error)
+
+	// Recorder records every message exchanged with iTerm2, see NewRecorder.
+	Recorder *Recorder
+
+	// Logger receives connection events and protocol errors. At debug level it also
+	// traces every call with its message type, id and latency. Nil means no logging at all.
+	Logger *slog.Logger
+
+	// Interceptors run around every call, the first one being the outermost,
+	// e.g. the Intercept method of a StatsCollector or a SlowCallLogger.
+	Interceptors []Interceptor
+
+	// KeepaliveInterval is how often the connection is checked with a ping.
+	// A pong missing after KeepaliveTimeout is handled like a broken connection.
+	// Zero disables the keepalive.
+	KeepaliveInterval time.Duration
+
+	// KeepaliveTimeout is how long to wait for a pong. Defaults to KeepaliveInterval.
+	KeepaliveTimeout time.Duration
+
+	// Reconnect makes the client dial iTerm2 again after the connection is lost instead of closing.
+	// Every active notification subscription and tool registration is replayed on the new connection.
+	// Those iTerm2 refuses, e.g. the subscriptions of sessions gone after iTerm2 restarted, are cancelled.
+	Reconnect bool
+
+	// ReconnectMinDelay is the delay before the first reconnect attempt, doubled after each failure.
+	// Defaults to 500 milliseconds.
+	ReconnectMinDelay time.Duration
+
+	// ReconnectMaxDelay caps the delay between two reconnect attempts. Defaults to 30 seconds.
+	ReconnectMaxDelay time.Duration
+
+	// ReconnectMaxAttempts is the number of failed attempts after which the client gives up and closes.
+	// Zero means retrying forever.
+	ReconnectMaxAttempts int
+}
+
+func (o *Options) reconnectMinDelay() time.Duration {
+	if o.ReconnectMinDelay > 0 {
+		return o.ReconnectMinDelay
+	}
+	return 500 * time.Millisecond
+}
+
+func (o *Options) reconnectMaxDelay() time.Duration {
+	if o.ReconnectMaxDelay > 0 {
+		return o.ReconnectMaxDelay
+	}
+	return 30 * time.Second
+}
+
+func (o *Options) keepaliveTimeout() time.Duration {
+	if o.KeepaliveTimeout > 0 {
+		return o.KeepaliveTimeout
+	}
+	return o.KeepaliveInterval
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/trzsz/iterm2/api"
+)
+
+// reconnect dials iTerm2 with exponential backoff until a new connection is
+// established and every subscription has been replayed on it
+func (c *Client) reconnect() {
+	delay := c.opts.reconnectMinDelay()
+	var err error
+	for attempt := 1; c.opts.ReconnectMaxAttempts <= 0 || attempt <= c.opts.ReconnectMaxAttempts; attempt++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.done:
+			timer.Stop()
+			return
+		}
+		delay = min(delay*2, c.opts.reconnectMaxDelay())
+
+		var cn *conn
+		cn, err = c.dial()
+		if err != nil {
+			c.log.Info("iterm2: reconnect failed", "attempt", attempt, "error", err)
+			continue
+		}
+		go cn.readWorker()
+		go cn.keepalive()
+		if err = c.replay(cn); err != nil || c.closed.Load() {
+			cn.fail(cmp.Or(err, ErrClosed))
+			c.log.Info("iterm2: reconnect failed", "attempt", attempt, "error", cmp.Or(err, ErrClosed))
+			continue
+		}
+		if !c.resume(cn) {
+			cn.fail(ErrClosed)
+			err = cn.err
+			c.log.Info("iterm2: reconnect failed", "attempt", attempt, "error", err)
+			continue
+		}
+		c.log.Info("iterm2: reconnected", "attempt", attempt)
+		c.hmu.Lock()
+		handlers := slices.Clone(c.onBack)
+		c.hmu.Unlock()
+		for _, fn := range handlers {
+			fn()
+		}
+		return
+	}
+	c.log.Warn("iterm2: giving up reconnecting", "error", err)
+	c.shutdown(fmt.Errorf("%w: reconnect failed: %v", ErrConnectionLost, err))
+}
+
+// replay re-sends every active subscription and tool registration on cn. Only a broken
+// connection fails the replay: the subscriptions and tool registrations refused by iTerm2,
+// e.g. those of sessions that are gone after iTerm2 restarted, are dropped instead.
+func (c *Client) replay(cn *conn) error {
+	c.smu.Lock()
+	reqs := make([]*api.NotificationRequest, 0, len(c.subs))
+	for _, g := range c.subs {
+		reqs = append(reqs, g.req)
+	}
+	tools := make([]*api.RegisterToolRequest, 0, len(c.tools))
+	for _, tool := range c.tools {
+		tools = append(tools, tool)
+	}
+	c.smu.Unlock()
+
+	ctx := context.Background()
+	for _, req := range reqs {
+		resp, err := cn.call(ctx, newNotificationMessage(req))
+		if err != nil {
+			return fmt.Errorf("replay notification_request failed: %w", err)
+		}
+		if err := checkNotificationResponse(resp); err != nil && !errors.Is(err, ErrAlreadySubscribed) {
+			c.log.Warn("iterm2: dropping subscription", "type", req.GetNotificationType(), "session", req.GetSession(), "error", err)
+			c.dropSubscriptions(func(other *api.NotificationRequest) bool { return other == req })
+		}
+	}
+	for _, tool := range tools {
+		resp, err := cn.call(ctx, &api.ClientOriginatedMessage{
+			Submessage: &api.ClientOriginatedMessage_RegisterToolRequest{
+				RegisterToolRequest: tool,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("replay register_tool_request failed: %w", err)
+		}
+		if status := resp.GetRegisterToolResponse().GetStatus(); status != api.RegisterToolResponse_OK {
+			err := &StatusError{Response: "register_tool_response", Status: status}
+			c.log.Warn("iterm2: dropping tool registration", "identifier", tool.GetIdentifier(), "error", err)
+			c.smu.Lock()
+			if c.tools[tool.GetIdentifier()] == tool {
+				delete(c.tools, tool.GetIdentifier())
+			}
+			c.smu.Unlock()
+		}
+	}
+	return nil
+}
+
+// resume makes cn the current connection unless it has already failed or the client
+// has been closed meanwhile, in which case the caller must fail cn
+func (c *Client) resume(cn *conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-cn.done:
+		return false
+	case <-c.done:
+		return false
+	default:
+	}
+	c.cn = cn
+	close(c.ready)
+	return true
+}
@@ -0,0 +1,170 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+	"github.com/trzsz/iterm2/iterm2test"
+	"google.golang.org/protobuf/proto"
+)
+
+func reconnecting(opts *client.Options) {
+	opts.Reconnect = true
+	opts.ReconnectMinDelay = time.Millisecond
+	opts.ReconnectMaxDelay = 10 * time.Millisecond
+}
+
+func subscribeChan(t *testing.T, c *client.Client, typ api.NotificationType, session string) <-chan *api.Notification {
+	t.Helper()
+	req := &api.NotificationRequest{NotificationType: typ.Enum()}
+	if session != "" {
+		req.Session = proto.String(session)
+	}
+	ch, _, err := c.SubscribeChan(req, 16)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	return ch
+}
+
+// waitReconnect drops the connections of srv and waits until c is back
+func waitReconnect(t *testing.T, srv *iterm2test.Server, c *client.Client) {
+	t.Helper()
+	back := make(chan struct{}, 1)
+	c.OnReconnect(func() { back <- struct{}{} })
+	srv.DropConnections()
+	select {
+	case <-back:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the client to reconnect")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, reconnecting)
+	lost := make(chan error, 1)
+	c.OnDisconnect(func(err error) { lost <- err })
+	ch := subscribeChan(t, c, api.NotificationType_NOTIFY_ON_NEW_SESSION, "")
+
+	waitReconnect(t, srv, c)
+	if err := receiveErr(t, lost); !errors.Is(err, client.ErrConnectionLost) {
+		t.Fatalf("disconnect error = %v, want %v", err, client.ErrConnectionLost)
+	}
+	if c.IsClosed() {
+		t.Fatal("a reconnecting client should not be closed")
+	}
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call after reconnect failed: %v", err)
+	}
+
+	// the subscription has been replayed on the new connection
+	_, _, sid := srv.CreateWindow()
+	select {
+	case n := <-ch:
+		if got := n.GetNewSessionNotification().GetSessionId(); got != sid {
+			t.Fatalf("new session = %v, want %v", got, sid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a notification after reconnect")
+	}
+}
+
+func TestReconnectDropsSubscriptionsOfGoneSessions(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, reconnecting)
+	_, _, sid := srv.CreateWindow()
+	gone := subscribeChan(t, c, api.NotificationType_NOTIFY_ON_SCREEN_UPDATE, sid)
+	alive := subscribeChan(t, c, api.NotificationType_NOTIFY_ON_NEW_SESSION, "")
+
+	srv.TerminateSession(sid)
+	waitReconnect(t, srv, c)
+	waitClosed(t, gone)
+
+	_, _, sid = srv.CreateWindow()
+	select {
+	case n := <-alive:
+		if got := n.GetNewSessionNotification().GetSessionId(); got != sid {
+			t.Fatalf("new session = %v, want %v", got, sid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a notification after reconnect")
+	}
+}
+
+func TestTerminateSessionDropsItsSubscriptions(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, nil)
+	_, _, sid := srv.CreateWindow()
+	updates := subscribeChan(t, c, api.NotificationType_NOTIFY_ON_SCREEN_UPDATE, sid)
+	terminated := subscribeChan(t, c, api.NotificationType_NOTIFY_ON_TERMINATE_SESSION, "")
+
+	srv.TerminateSession(sid)
+	select {
+	case <-terminated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the terminate notification")
+	}
+	waitClosed(t, updates)
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, func(opts *client.Options) {
+		reconnecting(opts)
+		opts.ReconnectMaxAttempts = 2
+	})
+	ch := subscribeChan(t, c, api.NotificationType_NOTIFY_ON_NEW_SESSION, "")
+
+	_ = srv.Close()
+	waitClosed(t, ch)
+	if !c.IsClosed() {
+		t.Fatal("client should be closed after the last reconnect attempt")
+	}
+	if err := listSessions(context.Background(), c); !errors.Is(err, client.ErrConnectionLost) {
+		t.Fatalf("call error = %v, want %v", err, client.ErrConnectionLost)
+	}
+}
+
+func TestCloseWhileReconnecting(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, reconnecting)
+	ch := subscribeChan(t, c, api.NotificationType_NOTIFY_ON_NEW_SESSION, "")
+	back := make(chan struct{}, 1)
+	c.OnReconnect(func() { back <- struct{}{} })
+
+	srv.DropConnections()
+	_ = c.Close()
+	waitClosed(t, ch)
+	if err := listSessions(context.Background(), c); !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("call error = %v, want %v", err, client.ErrClosed)
+	}
+	select {
+	case <-back:
+		t.Fatal("a closed client should not reconnect")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if c.Healthy() {
+		t.Fatal("a closed client should not be healthy")
+	}
+}
+
+// waitClosed drains ch, failing the test if it is not closed in time
+func waitClosed[T any](t *testing.T, ch <-chan T) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for the channel to be closed")
+		}
+	}
+}
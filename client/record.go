@@ -0,0 +1,241 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// RecordFormat is the encoding of a recording
+type RecordFormat int
+
+const (
+	// RecordJSON writes one JSON object per line, with the message encoded as protojson
+	RecordJSON RecordFormat = iota
+
+	// RecordBinary writes length-delimited records: a uvarint length followed by one byte
+	// for the direction, the big endian unix time in nanoseconds and the protobuf message
+	RecordBinary
+)
+
+// Record is one message exchanged with iTerm2. Exactly one of Request and Response is set.
+type Record struct {
+	Time     time.Time
+	Request  *api.ClientOriginatedMessage
+	Response *api.ServerOriginatedMessage
+}
+
+// Recorder writes the traffic of a Client to w. It is safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format RecordFormat
+	err    error
+}
+
+// NewRecorder returns a Recorder that writes records to w in the given format
+func NewRecorder(w io.Writer, format RecordFormat) *Recorder {
+	return &Recorder{w: w, format: format}
+}
+
+// Err returns the first error that happened while writing records
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Write appends rec to the recording
+func (r *Recorder) Write(rec *Record) error {
+	var b []byte
+	var err error
+	switch r.format {
+	case RecordJSON:
+		b, err = marshalJSONRecord(rec)
+	case RecordBinary:
+		b, err = marshalBinaryRecord(rec)
+	default:
+		err = fmt.Errorf("unknown record format: %d", r.format)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		_, err = r.w.Write(b)
+	}
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+// write records a raw message read from or written to a Transport
+func (r *Recorder) write(msg []byte, sent bool) {
+	rec := &Record{Time: time.Now()}
+	var err error
+	if sent {
+		rec.Request = &api.ClientOriginatedMessage{}
+		err = proto.Unmarshal(msg, rec.Request)
+	} else {
+		rec.Response = &api.ServerOriginatedMessage{}
+		err = proto.Unmarshal(msg, rec.Response)
+	}
+	if err != nil {
+		r.mu.Lock()
+		if r.err == nil {
+			r.err = fmt.Errorf("record message failed: %w", err)
+		}
+		r.mu.Unlock()
+		return
+	}
+	_ = r.Write(rec)
+}
+
+type jsonRecord struct {
+	Time     time.Time       `json:"time"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+func marshalJSONRecord(rec *Record) ([]byte, error) {
+	jr := jsonRecord{Time: rec.Time}
+	var err error
+	if rec.Request != nil {
+		jr.Request, err = protojson.Marshal(rec.Request)
+	} else {
+		jr.Response, err = protojson.Marshal(rec.Response)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(&jr)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func marshalBinaryRecord(rec *Record) ([]byte, error) {
+	var msg []byte
+	var err error
+	direction := byte(0)
+	if rec.Request != nil {
+		msg, err = proto.Marshal(rec.Request)
+	} else {
+		direction = 1
+		msg, err = proto.Marshal(rec.Response)
+	}
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 9, 9+len(msg))
+	payload[0] = direction
+	binary.BigEndian.PutUint64(payload[1:], uint64(rec.Time.UnixNano()))
+	payload = append(payload, msg...)
+	return append(binary.AppendUvarint(nil, uint64(len(payload))), payload...), nil
+}
+
+// ReadRecords reads a whole recording written in the given format
+func ReadRecords(r io.Reader, format RecordFormat) ([]*Record, error) {
+	switch format {
+	case RecordJSON:
+		return readJSONRecords(r)
+	case RecordBinary:
+		return readBinaryRecords(r)
+	}
+	return nil, fmt.Errorf("unknown record format: %d", format)
+}
+
+func readJSONRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	dec := json.NewDecoder(r)
+	for {
+		var jr jsonRecord
+		if err := dec.Decode(&jr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, fmt.Errorf("read record %d failed: %w", len(records), err)
+		}
+		rec := &Record{Time: jr.Time}
+		var err error
+		switch {
+		case jr.Request != nil:
+			rec.Request = &api.ClientOriginatedMessage{}
+			err = protojson.Unmarshal(jr.Request, rec.Request)
+		case jr.Response != nil:
+			rec.Response = &api.ServerOriginatedMessage{}
+			err = protojson.Unmarshal(jr.Response, rec.Response)
+		default:
+			err = fmt.Errorf("neither request nor response")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read record %d failed: %w", len(records), err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func readBinaryRecords(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	br := bufio.NewReader(r)
+	for {
+		size, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read record %d failed: %w", len(records), err)
+		}
+		if size < 9 {
+			return nil, fmt.Errorf("read record %d failed: record too short: %d", len(records), size)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return nil, fmt.Errorf("read record %d failed: %w", len(records), err)
+		}
+		rec := &Record{Time: time.Unix(0, int64(binary.BigEndian.Uint64(payload[1:9])))}
+		switch payload[0] {
+		case 0:
+			rec.Request = &api.ClientOriginatedMessage{}
+			err = proto.Unmarshal(payload[9:], rec.Request)
+		case 1:
+			rec.Response = &api.ServerOriginatedMessage{}
+			err = proto.Unmarshal(payload[9:], rec.Response)
+		default:
+			err = fmt.Errorf("unknown direction: %d", payload[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read record %d failed: %w", len(records), err)
+		}
+		records = append(records, rec)
+	}
+}
+
+// recordingTransport copies every message going through a Transport to a Recorder
+type recordingTransport struct {
+	Transport
+	r *Recorder
+}
+
+func (t *recordingTransport) ReadMessage() ([]byte, error) {
+	msg, err := t.Transport.ReadMessage()
+	if err == nil {
+		t.r.write(msg, false)
+	}
+	return msg, err
+}
+
+func (t *recordingTransport) WriteMessage(msg []byte) error {
+	t.r.write(msg, true)
+	return t.Transport.WriteMessage(msg)
+}
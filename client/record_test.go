@@ -0,0 +1,85 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+	"google.golang.org/protobuf/proto"
+)
+
+// session sends a few requests and returns their responses
+func session(t *testing.T, c *client.Client) []*api.ServerOriginatedMessage {
+	t.Helper()
+	var responses []*api.ServerOriginatedMessage
+	for _, req := range []*api.ClientOriginatedMessage{
+		{Submessage: &api.ClientOriginatedMessage_CreateTabRequest{CreateTabRequest: &api.CreateTabRequest{}}},
+		{Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{ListSessionsRequest: &api.ListSessionsRequest{}}},
+	} {
+		resp, err := c.Call(req)
+		if err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+// replayClient connects a client to a ReplayTransport serving records
+func replayClient(t *testing.T, records []*client.Record) *client.Client {
+	t.Helper()
+	c, err := client.NewWithOptions("test", client.Options{
+		NewTransport: func() (client.Transport, error) { return client.NewReplayTransport(records), nil },
+	})
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	for _, format := range []client.RecordFormat{client.RecordJSON, client.RecordBinary} {
+		srv := newTestServer(t)
+		var buf bytes.Buffer
+		recorder := client.NewRecorder(&buf, format)
+		c := newTestClient(t, srv, func(opts *client.Options) { opts.Recorder = recorder })
+		recorded := session(t, c)
+		_ = c.Close()
+		if err := recorder.Err(); err != nil {
+			t.Fatalf("format %d: record failed: %v", format, err)
+		}
+
+		records, err := client.ReadRecords(&buf, format)
+		if err != nil {
+			t.Fatalf("format %d: read records failed: %v", format, err)
+		}
+		if len(records) != 4 || records[0].Request == nil || records[1].Response == nil || records[0].Time.IsZero() {
+			t.Fatalf("format %d: records = %v, want two requests and their responses", format, records)
+		}
+
+		replayed := session(t, replayClient(t, records))
+		for i := range recorded {
+			if !proto.Equal(replayed[i], recorded[i]) {
+				t.Fatalf("format %d: replayed response %d = %v, want %v", format, i, replayed[i], recorded[i])
+			}
+		}
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	records := []*client.Record{{Request: &api.ClientOriginatedMessage{
+		Id:         proto.Int64(1),
+		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{ListSessionsRequest: &api.ListSessionsRequest{}},
+	}}}
+	c := replayClient(t, records)
+	_, err := c.CallContext(context.Background(), &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{CreateTabRequest: &api.CreateTabRequest{}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "got create_tab_request, recorded list_sessions_request") {
+		t.Fatalf("call error = %v, want a mismatch", err)
+	}
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReplayTransport is a Transport that answers requests from a recording instead of iTerm2.
+//
+// Recorded requests must be sent again in the same order with the same kind of submessage.
+// Each recorded message from iTerm2 is delivered once every request recorded before it has
+// been sent, with its id rewritten to the id of the matching live request.
+type ReplayTransport struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	records []*Record
+	sent    int // index of the next request record to match
+	read    int // index of the next response record to deliver
+	ids     map[int64]int64
+	closed  bool
+}
+
+// NewReplayTransport returns a ReplayTransport serving the given records,
+// which are usually read from a file with ReadRecords
+func NewReplayTransport(records []*Record) *ReplayTransport {
+	t := &ReplayTransport{records: records, ids: make(map[int64]int64)}
+	t.cond = sync.NewCond(&t.mu)
+	t.sent = t.next(0, true)
+	t.read = t.next(0, false)
+	return t
+}
+
+// next returns the index of the first request or response record at or after i
+func (t *ReplayTransport) next(i int, request bool) int {
+	for ; i < len(t.records); i++ {
+		if (t.records[i].Request != nil) == request {
+			break
+		}
+	}
+	return i
+}
+
+// ReadMessage implements Transport. It blocks when the recording is exhausted until Close is called.
+func (t *ReplayTransport) ReadMessage() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for !t.closed && (t.read >= len(t.records) || t.read > t.sent) {
+		t.cond.Wait()
+	}
+	if t.closed {
+		return nil, io.EOF
+	}
+	resp := proto.Clone(t.records[t.read].Response).(*api.ServerOriginatedMessage)
+	t.read = t.next(t.read+1, false)
+	if resp.Id != nil {
+		id, ok := t.ids[resp.GetId()]
+		if !ok {
+			return nil, fmt.Errorf("replay: response %d does not match any request", resp.GetId())
+		}
+		resp.Id = &id
+	}
+	return proto.Marshal(resp)
+}
+
+// WriteMessage implements Transport. It fails if the request differs from the recorded one.
+func (t *ReplayTransport) WriteMessage(msg []byte) error {
+	var req api.ClientOriginatedMessage
+	if err := proto.Unmarshal(msg, &req); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return io.ErrClosedPipe
+	}
+	if t.sent >= len(t.records) {
+		return fmt.Errorf("replay: unexpected %s after the end of the recording", submessageName(&req))
+	}
+	recorded := t.records[t.sent].Request
+	if submessageName(recorded) != submessageName(&req) {
+		return fmt.Errorf("replay: got %s, recorded %s", submessageName(&req), submessageName(recorded))
+	}
+	t.ids[recorded.GetId()] = req.GetId()
+	t.sent = t.next(t.sent+1, true)
+	t.cond.Broadcast()
+	return nil
+}
+
+// Close implements Transport
+func (t *ReplayTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.cond.Broadcast()
+	return nil
+}
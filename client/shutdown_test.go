@@ -0,0 +1,68 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2/client"
+)
+
+func TestShutdownWaitsForCalls(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, nil)
+
+	release := blockListSessions(srv)
+	errc := make(chan error, 1)
+	go func() { errc <- listSessions(context.Background(), c) }()
+	time.Sleep(20 * time.Millisecond)
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- c.Shutdown(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := listSessions(context.Background(), c); !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("call during shutdown error = %v, want %v", err, client.ErrClosed)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned %v before the call in flight completed", err)
+	default:
+	}
+	release()
+	if err := receiveErr(t, errc); err != nil {
+		t.Fatalf("call in flight failed: %v", err)
+	}
+	if err := receiveErr(t, shutdown); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if !c.IsClosed() {
+		t.Fatal("client should be closed after shutdown")
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("second shutdown failed: %v", err)
+	}
+}
+
+func TestShutdownExpired(t *testing.T) {
+	srv := newTestServer(t)
+	c := newTestClient(t, srv, nil)
+
+	release := blockListSessions(srv)
+	defer release()
+	errc := make(chan error, 1)
+	go func() { errc <- listSessions(context.Background(), c) }()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := receiveErr(t, errc); !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("call in flight error = %v, want %v", err, client.ErrClosed)
+	}
+	if !c.IsClosed() {
+		t.Fatal("client should be closed after shutdown")
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries encoded protobuf messages between a Client and iTerm2.
+// WriteMessage is never called concurrently, and neither is ReadMessage.
+type Transport interface {
+	// ReadMessage blocks until the next ServerOriginatedMessage arrives
+	ReadMessage() ([]byte, error)
+	// WriteMessage sends one ClientOriginatedMessage
+	WriteMessage(msg []byte) error
+	// Close unblocks ReadMessage and releases the resources of the transport
+	Close() error
+}
+
+// Pinger is implemented by a Transport supporting keepalive pings, see Options.KeepaliveInterval
+type Pinger interface {
+	// Ping sends a ping, giving up at deadline
+	Ping(deadline time.Time) error
+	// OnPong registers fn to be called by ReadMessage whenever a pong is received
+	OnPong(fn func())
+}
+
+// wsTransport is the Transport used to talk to iTerm2 over a websocket
+type wsTransport struct {
+	ws *websocket.Conn
+	// version is the X-iTerm2-Protocol-Version header of the handshake response
+	version string
+}
+
+func (t *wsTransport) ReadMessage() ([]byte, error) {
+	_, msg, err := t.ws.ReadMessage()
+	return msg, err
+}
+
+func (t *wsTransport) WriteMessage(msg []byte) error {
+	return t.ws.WriteMessage(websocket.BinaryMessage, msg)
+}
+
+func (t *wsTransport) Close() error {
+	return t.ws.Close()
+}
+
+func (t *wsTransport) Ping(deadline time.Time) error {
+	return t.ws.WriteControl(websocket.PingMessage, nil, deadline)
+}
+
+func (t *wsTransport) OnPong(fn func()) {
+	t.ws.SetPongHandler(func(string) error {
+		fn()
+		return nil
+	})
+}
+
+// DefaultSocketPath is where iTerm2 listens for API connections, relative to the home directory
+const DefaultSocketPath = "Library/Application Support/iTerm2/private/socket"
+
+// endpoint resolves where to connect to, in order of precedence: Options.URL,
+// Options.SocketPath, the ITERM2_SOCKET environment variable and DefaultSocketPath.
+// It returns the websocket URL, then the network ("unix" or "tcp") and the address to dial.
+func (o *Options) endpoint() (string, string, string, error) {
+	if o.URL != "" {
+		return tcpEndpoint(o.URL)
+	}
+	path := o.SocketPath
+	if path == "" {
+		path = os.Getenv("ITERM2_SOCKET")
+		if strings.HasPrefix(path, "ws://") {
+			return tcpEndpoint(path)
+		}
+	}
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", "", fmt.Errorf("os.UserHomeDir: %w", err)
+		}
+		path = filepath.Join(homeDir, DefaultSocketPath)
+	}
+	return "ws://localhost", "unix", path, nil
+}
+
+func tcpEndpoint(url string) (string, string, string, error) {
+	host, ok := strings.CutPrefix(url, "ws://")
+	if !ok {
+		return "", "", "", fmt.Errorf("unsupported iTerm2 url: %q", url)
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return "", "", "", fmt.Errorf("invalid iTerm2 url %q: %w", url, err)
+	}
+	return "ws://" + host, "tcp", host, nil
+}
+
+// errRejected is wrapped by the errors of dialWebsocket when iTerm2 refused the credentials
+var errRejected = errors.New("credentials rejected")
+
+func dialWebsocket(opts *Options, creds *Credentials) (*wsTransport, error) {
+	h := http.Header{}
+	h.Set("origin", "ws://localhost/")
+	h.Set("x-iterm2-library-version", "go 3.6")
+	h.Set("x-iterm2-disable-auth-ui", "true")
+	h.Set("x-iterm2-cookie", creds.Cookie)
+	if creds.Key != "" {
+		h.Set("x-iterm2-key", creds.Key)
+	}
+	url, network, addr, err := opts.endpoint()
+	if err != nil {
+		return nil, err
+	}
+	dial := opts.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	d := &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dial(ctx, network, addr)
+		},
+		HandshakeTimeout: 45 * time.Second,
+		Subprotocols:     []string{"api.iterm2.com"},
+	}
+	c, resp, err := d.Dial(url, h)
+	if err != nil && resp != nil {
+		b, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("error connecting to iTerm2: %w: %v - body: %s", errRejected, err, b)
+		}
+		return nil, fmt.Errorf("error connecting to iTerm2: %v - body: %s", err, b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to iTerm2: %v", err)
+	}
+	return &wsTransport{ws: c, version: resp.Header.Get("X-iTerm2-Protocol-Version")}, nil
+}
@@ -0,0 +1,94 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/trzsz/iterm2/client"
+	"github.com/trzsz/iterm2/iterm2test"
+)
+
+func TestEndpoint(t *testing.T) {
+	home := t.TempDir()
+	for _, tt := range []struct {
+		name    string
+		opts    client.Options
+		env     string
+		network string
+		addr    string
+	}{
+		{"url", client.Options{URL: "ws://localhost:1912", SocketPath: "/tmp/socket"}, "/tmp/env", "tcp", "localhost:1912"},
+		{"url with path", client.Options{URL: "ws://127.0.0.1:1912/api"}, "", "tcp", "127.0.0.1:1912"},
+		{"socket path", client.Options{SocketPath: "/tmp/socket"}, "/tmp/env", "unix", "/tmp/socket"},
+		{"env path", client.Options{}, "/tmp/env", "unix", "/tmp/env"},
+		{"env url", client.Options{}, "ws://localhost:1912", "tcp", "localhost:1912"},
+		{"default", client.Options{}, "", "unix", filepath.Join(home, client.DefaultSocketPath)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", home)
+			t.Setenv("ITERM2_SOCKET", tt.env)
+			var network, addr string
+			opts := tt.opts
+			opts.Credentials = []client.CredentialProvider{client.StaticCredentials{Cookie: iterm2test.Cookie}}
+			opts.Dial = func(_ context.Context, n, a string) (net.Conn, error) {
+				network, addr = n, a
+				return nil, errors.New("not dialing")
+			}
+			if _, err := client.NewWithOptions("test", opts); err == nil {
+				t.Fatal("connect should fail")
+			}
+			if network != tt.network || addr != tt.addr {
+				t.Fatalf("dialed %s %s, want %s %s", network, addr, tt.network, tt.addr)
+			}
+		})
+	}
+}
+
+func TestEndpointInvalidURL(t *testing.T) {
+	for _, tt := range []struct {
+		url, want string
+	}{
+		{"wss://localhost:1912", "unsupported iTerm2 url"},
+		{"ws://localhost", "invalid iTerm2 url"},
+	} {
+		dialed := false
+		_, err := client.NewWithOptions("test", client.Options{
+			URL:         tt.url,
+			Credentials: []client.CredentialProvider{client.StaticCredentials{Cookie: iterm2test.Cookie}},
+			Dial: func(context.Context, string, string) (net.Conn, error) {
+				dialed = true
+				return nil, errors.New("not dialing")
+			},
+		})
+		if err == nil || !strings.Contains(err.Error(), tt.want) || dialed {
+			t.Errorf("connect to %s error = %v after dialing %v, want %q without dialing", tt.url, err, dialed, tt.want)
+		}
+	}
+}
+
+func TestDialResolvedAddress(t *testing.T) {
+	srv := newTestServer(t)
+	var network, addr string
+	c, err := client.NewWithOptions("test", client.Options{
+		SocketPath:  srv.SocketPath(),
+		Credentials: []client.CredentialProvider{client.StaticCredentials{Cookie: iterm2test.Cookie}},
+		Dial: func(ctx context.Context, n, a string) (net.Conn, error) {
+			network, addr = n, a
+			return (&net.Dialer{}).DialContext(ctx, n, a)
+		},
+	})
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	if network != "unix" || addr != srv.SocketPath() {
+		t.Fatalf("dialed %s %s, want unix %s", network, addr, srv.SocketPath())
+	}
+	if err := listSessions(context.Background(), c); err != nil {
+		t.Fatalf("call through the dialed connection failed: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package iterm2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/trzsz/iterm2/api"
+)
+
+// CloseTarget is a *Session, *Tab or *Window that App.CloseTargets can close
+type CloseTarget interface {
+	// closeTarget returns the kind of target, in the order they are closed, and the target id
+	closeTarget() (closeKind, string)
+}
+
+type closeKind int
+
+const (
+	closeSessions closeKind = iota
+	closeTabs
+	closeWindows
+)
+
+func (s *Session) closeTarget() (closeKind, string) { return closeSessions, s.sid }
+
+func (t *Tab) closeTarget() (closeKind, string) { return closeTabs, t.tid }
+
+func (w *Window) closeTarget() (closeKind, string) { return closeWindows, w.wid }
+
+// Close closes the session. Unless force is true, iTerm2 may ask the user for a
+// confirmation, e.g. when a job is running, and a refusal fails with ErrUserDeclined.
+func (s *Session) Close(force bool) error {
+	return s.CloseContext(context.Background(), force)
+}
+
+// CloseContext is like Close but takes a context
+func (s *Session) CloseContext(ctx context.Context, force bool) error {
+	return closeOne(ctx, s.app, force, s)
+}
+
+// Close closes the tab and its sessions, see Session.Close for force
+func (t *Tab) Close(force bool) error {
+	return t.CloseContext(context.Background(), force)
+}
+
+// CloseContext is like Close but takes a context
+func (t *Tab) CloseContext(ctx context.Context, force bool) error {
+	return closeOne(ctx, t.app, force, t)
+}
+
+// Close closes the window and its tabs, see Session.Close for force
+func (w *Window) Close(force bool) error {
+	return w.CloseContext(context.Background(), force)
+}
+
+// CloseContext is like Close but takes a context
+func (w *Window) CloseContext(ctx context.Context, force bool) error {
+	return closeOne(ctx, w.app, force, w)
+}
+
+func closeOne(ctx context.Context, a *App, force bool, target CloseTarget) error {
+	errs, err := a.CloseTargetsContext(ctx, force, target)
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return err
+}
+
+// CloseTargets closes sessions, tabs and windows, see Session.Close for force.
+// It returns the outcome of every target, in order: nil if it was closed, or a *StatusError
+// matching ErrNotFound or ErrUserDeclined. The error is non-nil if any target was not closed.
+// Sessions, tabs and windows are closed in that order; if a call fails, the targets not
+// closed yet get its error as outcome and the outcomes so far are still returned.
+func (a *App) CloseTargets(force bool, targets ...CloseTarget) ([]error, error) {
+	return a.CloseTargetsContext(context.Background(), force, targets...)
+}
+
+// CloseTargetsContext is like CloseTargets but takes a context
+func (a *App) CloseTargetsContext(ctx context.Context, force bool, targets ...CloseTarget) ([]error, error) {
+	defer a.invalidateCache()
+
+	var ids [closeWindows + 1][]string
+	var indexes [closeWindows + 1][]int
+	for i, target := range targets {
+		kind, id := target.closeTarget()
+		ids[kind] = append(ids[kind], id)
+		indexes[kind] = append(indexes[kind], i)
+	}
+
+	errs := make([]error, len(targets))
+	for kind := closeSessions; kind <= closeWindows; kind++ {
+		if len(ids[kind]) == 0 {
+			continue
+		}
+		req := &api.CloseRequest{Force: &force}
+		switch kind {
+		case closeSessions:
+			req.Target = &api.CloseRequest_Sessions{Sessions: &api.CloseRequest_CloseSessions{SessionIds: ids[kind]}}
+		case closeTabs:
+			req.Target = &api.CloseRequest_Tabs{Tabs: &api.CloseRequest_CloseTabs{TabIds: ids[kind]}}
+		case closeWindows:
+			req.Target = &api.CloseRequest_Windows{Windows: &api.CloseRequest_CloseWindows{WindowIds: ids[kind]}}
+		}
+		cResp, err := Do[*api.CloseResponse](ctx, a, req)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			// the statuses tell which targets were not closed
+			err = nil
+		}
+		statuses := cResp.GetStatuses()
+		if err == nil && len(statuses) != len(ids[kind]) {
+			err = fmt.Errorf("close_response statuses count is not %d: %v", len(ids[kind]), statuses)
+		}
+		if err != nil {
+			joined := errors.Join(errors.Join(errs...), err)
+			for ; kind <= closeWindows; kind++ {
+				for _, i := range indexes[kind] {
+					errs[i] = err
+				}
+			}
+			return errs, joined
+		}
+		for i, status := range statuses {
+			if status != api.CloseResponse_OK {
+				errs[indexes[kind][i]] = &StatusError{Response: "close_response", Status: status}
+			}
+		}
+	}
+	return errs, errors.Join(errs...)
+}
@@ -0,0 +1,118 @@
+package iterm2_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+)
+
+func TestClose(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	w, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	busy, err := s.SplitPane(iterm2.SplitPaneOptions{})
+	if err != nil {
+		t.Fatalf("split pane failed: %v", err)
+	}
+	srv.SetBusy(busy.GetSessionID(), true)
+
+	if err := busy.Close(false); !errors.Is(err, iterm2.ErrUserDeclined) {
+		t.Fatalf("close busy session error = %v, want %v", err, iterm2.ErrUserDeclined)
+	}
+	if err := busy.Close(true); err != nil {
+		t.Fatalf("force close busy session failed: %v", err)
+	}
+	if err := busy.Close(true); !errors.Is(err, iterm2.ErrNotFound) {
+		t.Fatalf("close closed session error = %v, want %v", err, iterm2.ErrNotFound)
+	}
+	if err := w.Close(false); err != nil {
+		t.Fatalf("close window failed: %v", err)
+	}
+	if layout, err := app.Layout(); err != nil || len(layout.Windows) != 0 {
+		t.Fatalf("layout = %+v, %v, want no window", layout, err)
+	}
+}
+
+func TestCloseTargets(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	cache := enableStateCache(t, app)
+	w, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	kept, err := s.SplitPane(iterm2.SplitPaneOptions{})
+	if err != nil {
+		t.Fatalf("split pane failed: %v", err)
+	}
+	tab, _, err := w.CreateTab()
+	if err != nil {
+		t.Fatalf("create tab failed: %v", err)
+	}
+	other, _, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+
+	errs, err := app.CloseTargets(false, s, tab, other, s)
+	if len(errs) != 4 || errs[0] != nil || errs[1] != nil || errs[2] != nil || !errors.Is(errs[3], iterm2.ErrNotFound) {
+		t.Fatalf("close errors = %v, want only the second close of the session to fail", errs)
+	}
+	if !errors.Is(err, iterm2.ErrNotFound) {
+		t.Fatalf("close error = %v, want %v", err, iterm2.ErrNotFound)
+	}
+
+	// the state cache must not keep the closed targets
+	layout, err := cache.Layout()
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	if sessions := layout.Sessions(); len(layout.Windows) != 1 || len(sessions) != 1 || sessions[0].ID != kept.GetSessionID() {
+		t.Fatalf("layout = %+v, want the split session left alone", layout)
+	}
+}
+
+func TestCloseTargetsFailure(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	w, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	tab, _, err := w.CreateTab()
+	if err != nil {
+		t.Fatalf("create tab failed: %v", err)
+	}
+	other, _, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	// answer the close of the tabs without any status
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetCloseRequest().GetTabs() == nil {
+			return nil
+		}
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_CloseResponse{
+			CloseResponse: &api.CloseResponse{},
+		}}
+	})
+
+	errs, err := app.CloseTargets(false, s, s, tab, other)
+	if len(errs) != 4 || errs[0] != nil || !errors.Is(errs[1], iterm2.ErrNotFound) {
+		t.Fatalf("close errors = %v, want the sessions closed before the failure", errs)
+	}
+	if errs[2] == nil || errs[3] != errs[2] {
+		t.Fatalf("close errors = %v, want the failure for the tab and the window", errs)
+	}
+	if !errors.Is(err, iterm2.ErrNotFound) || !errors.Is(err, errs[2]) {
+		t.Fatalf("close error = %v, want both the status and the failure", err)
+	}
+	if windows, err := app.ListWindows(); err != nil || len(windows) != 2 {
+		t.Fatalf("list windows = %v, %v, want the window left open", windows, err)
+	}
+}
@@ -0,0 +1,101 @@
+package iterm2
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Do sends req, one of the request messages of api.ClientOriginatedMessage such as
+// *api.GetBufferRequest, and returns the matching response, such as *api.GetBufferResponse.
+// A request needing a Feature that the connected iTerm2 lacks fails with ErrUnsupported.
+// A response whose status, or any of whose statuses as in *api.CloseResponse, is not OK
+// is returned along with a *StatusError, and so is an *api.InvokeFunctionResponse carrying
+// an error. The statuses nested in the results of an *api.PreferencesResponse are not checked.
+//
+//	resp, err := iterm2.Do[*api.GetBufferResponse](ctx, app, &api.GetBufferRequest{...})
+func Do[Resp proto.Message](ctx context.Context, a *App, req proto.Message) (Resp, error) {
+	var zero Resp
+	msg := &api.ClientOriginatedMessage{}
+	reqField := oneofField(msg.ProtoReflect(), req.ProtoReflect().Descriptor())
+	if reqField == nil {
+		return zero, fmt.Errorf("%s is not a request message", req.ProtoReflect().Descriptor().FullName())
+	}
+	respField := oneofField((&api.ServerOriginatedMessage{}).ProtoReflect(), zero.ProtoReflect().Descriptor())
+	if respField == nil {
+		return zero, fmt.Errorf("%s is not a response message", zero.ProtoReflect().Descriptor().FullName())
+	}
+	if err := a.requireRequest(req); err != nil {
+		return zero, err
+	}
+	msg.ProtoReflect().Set(reqField, protoreflect.ValueOfMessage(req.ProtoReflect()))
+
+	resp, err := a.c.CallContext(ctx, msg)
+	if err != nil {
+		return zero, fmt.Errorf("call %s failed: %w", reqField.Name(), err)
+	}
+
+	rm := resp.ProtoReflect()
+	if rm.WhichOneof(respField.ContainingOneof()) != respField {
+		return zero, fmt.Errorf("%s is nil", respField.Name())
+	}
+	typed := rm.Get(respField).Message()
+	return typed.Interface().(Resp), checkStatus(string(respField.Name()), typed)
+}
+
+// oneofField returns the field of the submessage oneof of m holding messages of type md
+func oneofField(m protoreflect.Message, md protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+	fields := m.Descriptor().Oneofs().ByName("submessage").Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); fd.Message() != nil && fd.Message().FullName() == md.FullName() {
+			return fd
+		}
+	}
+	return nil
+}
+
+// checkStatus returns a *StatusError if the status or statuses field of a response
+// is set to something other than OK, or if an invoke_function_response is an error
+func checkStatus(name string, m protoreflect.Message) error {
+	if ifResp, ok := m.Interface().(*api.InvokeFunctionResponse); ok {
+		if err := ifResp.GetError(); err != nil {
+			return invokeFunctionError(err)
+		}
+		return nil
+	}
+	fd := m.Descriptor().Fields().ByName("status")
+	if fd == nil {
+		fd = m.Descriptor().Fields().ByName("statuses")
+	}
+	if fd == nil || fd.Enum() == nil {
+		return nil
+	}
+	ok := fd.Enum().Values().ByName("OK")
+	if ok == nil {
+		return nil
+	}
+	statusError := func(v protoreflect.Value) error {
+		if v.Enum() == ok.Number() {
+			return nil
+		}
+		et, err := protoregistry.GlobalTypes.FindEnumByName(fd.Enum().FullName())
+		if err != nil {
+			return err
+		}
+		return &StatusError{Response: name, Status: et.New(v.Enum())}
+	}
+	if fd.IsList() {
+		list := m.Get(fd).List()
+		for i := 0; i < list.Len(); i++ {
+			if err := statusError(list.Get(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return statusError(m.Get(fd))
+}
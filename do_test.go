@@ -0,0 +1,70 @@
+package iterm2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDo(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	resp, err := iterm2.Do[*api.ListSessionsResponse](context.Background(), app, &api.ListSessionsRequest{})
+	if err != nil {
+		t.Fatalf("list sessions failed: %v", err)
+	}
+	if len(resp.GetWindows()) != 0 {
+		t.Fatalf("windows = %v, want none", resp.GetWindows())
+	}
+	if _, err := iterm2.Do[*api.ListSessionsResponse](context.Background(), app, &api.FocusRequest{}); err == nil {
+		t.Fatal("mismatched response type did not fail")
+	}
+}
+
+func TestDoChecksStatuses(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetCloseRequest() == nil {
+			return nil
+		}
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_CloseResponse{
+			CloseResponse: &api.CloseResponse{Statuses: []api.CloseResponse_Status{api.CloseResponse_OK, api.CloseResponse_NOT_FOUND}},
+		}}
+	})
+
+	resp, err := iterm2.Do[*api.CloseResponse](context.Background(), app, &api.CloseRequest{})
+	var statusErr *iterm2.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != api.CloseResponse_NOT_FOUND || !errors.Is(err, iterm2.ErrNotFound) {
+		t.Fatalf("close error = %v, want a NOT_FOUND status", err)
+	}
+	if len(resp.GetStatuses()) != 2 {
+		t.Fatalf("statuses = %v, want the response along with the error", resp.GetStatuses())
+	}
+}
+
+func TestDoChecksInvokeFunctionError(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetInvokeFunctionRequest() == nil {
+			return nil
+		}
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_InvokeFunctionResponse{
+			InvokeFunctionResponse: &api.InvokeFunctionResponse{Disposition: &api.InvokeFunctionResponse_Error_{
+				Error: &api.InvokeFunctionResponse_Error{Status: api.InvokeFunctionResponse_TIMEOUT.Enum(), ErrorReason: proto.String("too slow")},
+			}},
+		}}
+	})
+
+	_, err := iterm2.Do[*api.InvokeFunctionResponse](context.Background(), app, &api.InvokeFunctionRequest{Invocation: proto.String("f()")})
+	var statusErr *iterm2.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Reason != "too slow" || !errors.Is(err, iterm2.ErrTimeout) {
+		t.Fatalf("invoke function error = %v, want a TIMEOUT status", err)
+	}
+}
@@ -0,0 +1,53 @@
+package iterm2
+
+import (
+	"errors"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+)
+
+var (
+	// ErrClosed is returned by calls made after the App has been closed
+	ErrClosed = client.ErrClosed
+
+	// ErrConnectionLost is returned by calls once the connection to iTerm2 is broken
+	ErrConnectionLost = client.ErrConnectionLost
+
+	// ErrUnsupported is returned for a Feature that the connected iTerm2 lacks, see ServerInfo.Require
+	ErrUnsupported = errors.New("not supported by this version of iTerm2")
+)
+
+// StatusError is returned when iTerm2 answers a request with a status other than OK
+type StatusError = client.StatusError
+
+// Errors matching the non-OK statuses of the iTerm2 responses with errors.Is, see client.StatusError
+var (
+	ErrNotFound              = client.ErrNotFound
+	ErrMalformed             = client.ErrMalformed
+	ErrSessionNotFound       = client.ErrSessionNotFound
+	ErrWindowNotFound        = client.ErrWindowNotFound
+	ErrTabNotFound           = client.ErrTabNotFound
+	ErrInvalidID             = client.ErrInvalidID
+	ErrInvalidAssignment     = client.ErrInvalidAssignment
+	ErrTimeout               = client.ErrTimeout
+	ErrFailed                = client.ErrFailed
+	ErrDeferred              = client.ErrDeferred
+	ErrImpossible            = client.ErrImpossible
+	ErrUserDeclined          = client.ErrUserDeclined
+	ErrPermissionDenied      = client.ErrPermissionDenied
+	ErrDisabled              = client.ErrDisabled
+	ErrCannotSplit           = client.ErrCannotSplit
+	ErrSessionNotRestartable = client.ErrSessionNotRestartable
+	ErrPromptUnavailable     = client.ErrPromptUnavailable
+	ErrAlreadySubscribed     = client.ErrAlreadySubscribed
+	ErrNotSubscribed         = client.ErrNotSubscribed
+	ErrAlreadyInTransaction  = client.ErrAlreadyInTransaction
+	ErrNoTransaction         = client.ErrNoTransaction
+	ErrDuplicateRPC          = client.ErrDuplicateRPC
+)
+
+// invokeFunctionError converts the error of an invoke_function_response
+func invokeFunctionError(err *api.InvokeFunctionResponse_Error) error {
+	return &StatusError{Response: "invoke_function_response", Status: err.GetStatus(), Reason: err.GetErrorReason()}
+}
@@ -0,0 +1,117 @@
+package iterm2
+
+import (
+	"context"
+	"iter"
+)
+
+// Filter selects tabs and sessions while iterating over them with App.Sessions,
+// Window.Sessions or App.Tabs. The session is nil when filtering tabs.
+type Filter func(w *WindowInfo, t *TabInfo, s *SessionInfo) bool
+
+// InWindowNumber selects the tabs and sessions of the window with the given number
+func InWindowNumber(number int) Filter {
+	return func(w *WindowInfo, _ *TabInfo, _ *SessionInfo) bool {
+		return w.Number == number
+	}
+}
+
+// InTmuxConnection selects the tabs and sessions attached to the given tmux integration connection
+func InTmuxConnection(connectionID string) Filter {
+	return func(_ *WindowInfo, t *TabInfo, _ *SessionInfo) bool {
+		return t.TmuxConnectionID == connectionID
+	}
+}
+
+// WithTitle selects the sessions with the given title, and the tabs having such a session
+func WithTitle(title string) Filter {
+	return func(_ *WindowInfo, t *TabInfo, s *SessionInfo) bool {
+		if s != nil {
+			return s.Title == title
+		}
+		for _, s := range t.Sessions() {
+			if s.Title == title {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchFilters(filters []Filter, w *WindowInfo, t *TabInfo, s *SessionInfo) bool {
+	for _, filter := range filters {
+		if !filter(w, t, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sessions iterates over the sessions of every tab selected by all the filters.
+// The layout is read once when the iteration starts; an error stops the iteration.
+func (a *App) Sessions(filters ...Filter) iter.Seq2[*Session, error] {
+	return a.SessionsContext(context.Background(), filters...)
+}
+
+// SessionsContext is like Sessions but takes a context
+func (a *App) SessionsContext(ctx context.Context, filters ...Filter) iter.Seq2[*Session, error] {
+	return a.sessions(ctx, "", filters)
+}
+
+// Sessions iterates over the sessions of this window selected by all the filters.
+// The layout is read once when the iteration starts; an error stops the iteration.
+func (w *Window) Sessions(filters ...Filter) iter.Seq2[*Session, error] {
+	return w.SessionsContext(context.Background(), filters...)
+}
+
+// SessionsContext is like Sessions but takes a context
+func (w *Window) SessionsContext(ctx context.Context, filters ...Filter) iter.Seq2[*Session, error] {
+	return w.app.sessions(ctx, w.wid, filters)
+}
+
+// sessions iterates over the sessions of the window wid, or of every window if wid is empty
+func (a *App) sessions(ctx context.Context, wid string, filters []Filter) iter.Seq2[*Session, error] {
+	return func(yield func(*Session, error) bool) {
+		layout, err := a.LayoutContext(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, w := range layout.Windows {
+			if wid != "" && w.ID != wid {
+				continue
+			}
+			for _, t := range w.Tabs {
+				for _, s := range t.Sessions() {
+					if matchFilters(filters, &w, &t, &s) && !yield(newSession(a, w.ID, t.ID, s.ID), nil) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Tabs iterates over the tabs of every window selected by all the filters.
+// The layout is read once when the iteration starts; an error stops the iteration.
+func (a *App) Tabs(filters ...Filter) iter.Seq2[*Tab, error] {
+	return a.TabsContext(context.Background(), filters...)
+}
+
+// TabsContext is like Tabs but takes a context
+func (a *App) TabsContext(ctx context.Context, filters ...Filter) iter.Seq2[*Tab, error] {
+	return func(yield func(*Tab, error) bool) {
+		layout, err := a.LayoutContext(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, w := range layout.Windows {
+			for _, t := range w.Tabs {
+				if matchFilters(filters, &w, &t, nil) && !yield(newTab(a, w.ID, t.ID), nil) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package iterm2_test
+
+import (
+	"errors"
+	"iter"
+	"testing"
+
+	"github.com/trzsz/iterm2"
+)
+
+// count returns the number of values of seq, failing the test on an error
+func count[V any](t *testing.T, seq iter.Seq2[V, error]) int {
+	t.Helper()
+	n := 0
+	for _, err := range seq {
+		if err != nil {
+			t.Fatalf("iteration failed: %v", err)
+		}
+		n++
+	}
+	return n
+}
+
+func TestIterators(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	w, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	if _, err := s.SplitPane(iterm2.SplitPaneOptions{}); err != nil {
+		t.Fatalf("split pane failed: %v", err)
+	}
+	tab, _, err := w.CreateTab()
+	if err != nil {
+		t.Fatalf("create tab failed: %v", err)
+	}
+	_, other, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	srv.SetTmux(tab.GetTabID(), "1", "@1", s.GetSessionID())
+
+	layout, err := app.Layout()
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	otherNumber := layout.Windows[1].Number
+
+	for _, tt := range []struct {
+		name string
+		seq  iter.Seq2[*iterm2.Session, error]
+		want int
+	}{
+		{"all sessions", app.Sessions(), 4},
+		{"sessions of a window", w.Sessions(), 3},
+		{"sessions of a window number", app.Sessions(iterm2.InWindowNumber(otherNumber)), 1},
+		{"tmux sessions of a window", w.Sessions(iterm2.InTmuxConnection("1")), 1},
+	} {
+		if n := count(t, tt.seq); n != tt.want {
+			t.Errorf("%s: %d sessions, want %d", tt.name, n, tt.want)
+		}
+	}
+	if n := count(t, app.Tabs(iterm2.InTmuxConnection(""))); n != 2 {
+		t.Errorf("%d tabs outside tmux, want 2", n)
+	}
+	for session, err := range app.Sessions(iterm2.InWindowNumber(otherNumber)) {
+		if err != nil || session.GetSessionID() != other.GetSessionID() {
+			t.Fatalf("session = %v, %v, want %s", session, err, other.GetSessionID())
+		}
+		break
+	}
+
+	_ = app.Close()
+	var errs []error
+	for _, err := range app.Tabs() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], iterm2.ErrClosed) {
+		t.Fatalf("iteration errors = %v, want %v alone", errs, iterm2.ErrClosed)
+	}
+}
@@ -0,0 +1,720 @@
+package iterm2test
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *Server) handleLocked(sc *serverConn, req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+	switch sub := req.Submessage.(type) {
+	case *api.ClientOriginatedMessage_ListSessionsRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_ListSessionsResponse{
+			ListSessionsResponse: s.listSessionsLocked(),
+		}}
+	case *api.ClientOriginatedMessage_CreateTabRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_CreateTabResponse{
+			CreateTabResponse: s.createTabLocked(sub.CreateTabRequest),
+		}}
+	case *api.ClientOriginatedMessage_SplitPaneRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_SplitPaneResponse{
+			SplitPaneResponse: s.splitPaneLocked(sub.SplitPaneRequest),
+		}}
+	case *api.ClientOriginatedMessage_FocusRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_FocusResponse{
+			FocusResponse: &api.FocusResponse{Notifications: s.focusLocked()},
+		}}
+	case *api.ClientOriginatedMessage_ActivateRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_ActivateResponse{
+			ActivateResponse: s.activateLocked(sub.ActivateRequest),
+		}}
+	case *api.ClientOriginatedMessage_VariableRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_VariableResponse{
+			VariableResponse: s.variableLocked(sub.VariableRequest),
+		}}
+	case *api.ClientOriginatedMessage_SendTextRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_SendTextResponse{
+			SendTextResponse: s.sendTextLocked(sub.SendTextRequest),
+		}}
+	case *api.ClientOriginatedMessage_InjectRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_InjectResponse{
+			InjectResponse: s.injectLocked(sub.InjectRequest),
+		}}
+	case *api.ClientOriginatedMessage_GetBufferRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_GetBufferResponse{
+			GetBufferResponse: s.getBufferLocked(sub.GetBufferRequest),
+		}}
+	case *api.ClientOriginatedMessage_MenuItemRequest:
+		if !sub.MenuItemRequest.GetQueryOnly() {
+			s.menuItems = append(s.menuItems, sub.MenuItemRequest.GetIdentifier())
+		}
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_MenuItemResponse{
+			MenuItemResponse: &api.MenuItemResponse{
+				Status:  api.MenuItemResponse_OK.Enum(),
+				Enabled: proto.Bool(true),
+			},
+		}}
+	case *api.ClientOriginatedMessage_InvokeFunctionRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_InvokeFunctionResponse{
+			InvokeFunctionResponse: s.invokeFunctionLocked(sub.InvokeFunctionRequest),
+		}}
+	case *api.ClientOriginatedMessage_TmuxRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_TmuxResponse{
+			TmuxResponse: s.tmuxLocked(sub.TmuxRequest),
+		}}
+	case *api.ClientOriginatedMessage_NotificationRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_NotificationResponse{
+			NotificationResponse: s.notificationLocked(sc, sub.NotificationRequest),
+		}}
+	case *api.ClientOriginatedMessage_TransactionRequest:
+		status := api.TransactionResponse_OK
+		switch begin := sub.TransactionRequest.GetBegin(); {
+		case begin && sc.transaction:
+			status = api.TransactionResponse_ALREADY_IN_TRANSACTION
+		case !begin && !sc.transaction:
+			status = api.TransactionResponse_NO_TRANSACTION
+		default:
+			sc.transaction = begin
+		}
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_TransactionResponse{
+			TransactionResponse: &api.TransactionResponse{Status: status.Enum()},
+		}}
+	case *api.ClientOriginatedMessage_GetPropertyRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_GetPropertyResponse{
+			GetPropertyResponse: s.getPropertyLocked(sub.GetPropertyRequest),
+		}}
+	case *api.ClientOriginatedMessage_SetPropertyRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_SetPropertyResponse{
+			SetPropertyResponse: s.setPropertyLocked(sub.SetPropertyRequest),
+		}}
+	case *api.ClientOriginatedMessage_CloseRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_CloseResponse{
+			CloseResponse: s.closeLocked(sub.CloseRequest),
+		}}
+	case *api.ClientOriginatedMessage_RestartSessionRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_RestartSessionResponse{
+			RestartSessionResponse: s.restartSessionLocked(sub.RestartSessionRequest),
+		}}
+	case *api.ClientOriginatedMessage_ReorderTabsRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_ReorderTabsResponse{
+			ReorderTabsResponse: s.reorderTabsLocked(sub.ReorderTabsRequest),
+		}}
+	case *api.ClientOriginatedMessage_RegisterToolRequest:
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_RegisterToolResponse{
+			RegisterToolResponse: &api.RegisterToolResponse{Status: api.RegisterToolResponse_OK.Enum()},
+		}}
+	}
+	return errorMessage("unsupported request: %T", req.Submessage)
+}
+
+func (s *Server) createTabLocked(req *api.CreateTabRequest) *api.CreateTabResponse {
+	var w *window
+	if req.WindowId == nil {
+		w = s.newWindowLocked()
+	} else if w = s.findWindow(req.GetWindowId()); w == nil {
+		return &api.CreateTabResponse{Status: api.CreateTabResponse_INVALID_WINDOW_ID.Enum()}
+	}
+	index := -1
+	if req.TabIndex != nil {
+		index = int(req.GetTabIndex())
+	}
+	t := s.newTabLocked(w, index)
+	s.emitLocked(&api.Notification{NewSessionNotification: &api.NewSessionNotification{SessionId: proto.String(t.active)}})
+	s.emitLayoutLocked()
+	s.emitFocusLocked()
+	tid, _ := strconv.Atoi(t.id)
+	return &api.CreateTabResponse{
+		Status:    api.CreateTabResponse_OK.Enum(),
+		WindowId:  proto.String(w.id),
+		TabId:     proto.Int32(int32(tid)),
+		SessionId: proto.String(t.active),
+	}
+}
+
+func (s *Server) splitPaneLocked(req *api.SplitPaneRequest) *api.SplitPaneResponse {
+	sess := s.resolveSession(req.GetSession())
+	if sess == nil {
+		return &api.SplitPaneResponse{Status: api.SplitPaneResponse_SESSION_NOT_FOUND.Enum()}
+	}
+	_, _, n := s.locateSession(sess.id)
+	if n == nil {
+		return &api.SplitPaneResponse{Status: api.SplitPaneResponse_SESSION_NOT_FOUND.Enum()}
+	}
+	vertical := req.GetSplitDirection() == api.SplitPaneRequest_VERTICAL
+	if (vertical && sess.columns < 2) || (!vertical && sess.rows < 2) {
+		return &api.SplitPaneResponse{Status: api.SplitPaneResponse_CANNOT_SPLIT.Enum()}
+	}
+	newSess := s.newSessionLocked()
+	n.split(newSess, vertical, req.GetBefore())
+	s.emitLocked(&api.Notification{NewSessionNotification: &api.NewSessionNotification{SessionId: proto.String(newSess.id)}})
+	s.emitLayoutLocked()
+	return &api.SplitPaneResponse{
+		Status:    api.SplitPaneResponse_OK.Enum(),
+		SessionId: []string{newSess.id},
+	}
+}
+
+func (s *Server) closeLocked(req *api.CloseRequest) *api.CloseResponse {
+	var ids []string
+	// sessions returns the sessions to terminate for a target id, or nil if there is no such target
+	var sessions func(id string) []*session
+	switch target := req.Target.(type) {
+	case *api.CloseRequest_Sessions:
+		ids = target.Sessions.GetSessionIds()
+		sessions = func(id string) []*session {
+			if sess := s.resolveSession(id); sess != nil {
+				return []*session{sess}
+			}
+			return nil
+		}
+	case *api.CloseRequest_Tabs:
+		ids = target.Tabs.GetTabIds()
+		sessions = func(id string) []*session {
+			if _, t := s.findTab(id); t != nil {
+				return t.root.sessions()
+			}
+			return nil
+		}
+	case *api.CloseRequest_Windows:
+		ids = target.Windows.GetWindowIds()
+		sessions = func(id string) []*session {
+			var list []*session
+			if w := s.findWindow(id); w != nil {
+				for _, t := range w.tabs {
+					list = append(list, t.root.sessions()...)
+				}
+			}
+			return list
+		}
+	}
+	resp := &api.CloseResponse{}
+	closed := false
+	for _, id := range ids {
+		list := sessions(id)
+		if len(list) == 0 {
+			resp.Statuses = append(resp.Statuses, api.CloseResponse_NOT_FOUND)
+			continue
+		}
+		if !req.GetForce() && slices.ContainsFunc(list, func(sess *session) bool { return sess.busy }) {
+			resp.Statuses = append(resp.Statuses, api.CloseResponse_USER_DECLINED)
+			continue
+		}
+		for _, sess := range list {
+			s.terminateSessionLocked(sess.id)
+		}
+		resp.Statuses = append(resp.Statuses, api.CloseResponse_OK)
+		closed = true
+	}
+	if closed {
+		s.emitLayoutLocked()
+		s.emitFocusLocked()
+	}
+	return resp
+}
+
+func (s *Server) restartSessionLocked(req *api.RestartSessionRequest) *api.RestartSessionResponse {
+	sess := s.sessions[req.GetSessionId()]
+	if sess == nil {
+		return &api.RestartSessionResponse{Status: api.RestartSessionResponse_SESSION_NOT_FOUND.Enum()}
+	}
+	if req.GetOnlyIfExited() && !sess.exited {
+		return &api.RestartSessionResponse{Status: api.RestartSessionResponse_SESSION_NOT_RESTARTABLE.Enum()}
+	}
+	sess.exited, sess.busy, sess.output = false, false, nil
+	return &api.RestartSessionResponse{Status: api.RestartSessionResponse_OK.Enum()}
+}
+
+// reorderTabsLocked puts the tabs of every assignment first in its window, in the given order,
+// moving them from their windows as needed. The other tabs of the window stay after them.
+func (s *Server) reorderTabsLocked(req *api.ReorderTabsRequest) *api.ReorderTabsResponse {
+	status := func(status api.ReorderTabsResponse_Status) *api.ReorderTabsResponse {
+		return &api.ReorderTabsResponse{Status: status.Enum()}
+	}
+	seen := make(map[string]bool)
+	for _, a := range req.GetAssignments() {
+		if s.findWindow(a.GetWindowId()) == nil {
+			return status(api.ReorderTabsResponse_INVALID_WINDOW_ID)
+		}
+		for _, tid := range a.GetTabIds() {
+			if _, t := s.findTab(tid); t == nil {
+				return status(api.ReorderTabsResponse_INVALID_TAB_ID)
+			}
+			if seen[tid] {
+				return status(api.ReorderTabsResponse_INVALID_ASSIGNMENT)
+			}
+			seen[tid] = true
+		}
+	}
+	for _, a := range req.GetAssignments() {
+		target := s.findWindow(a.GetWindowId())
+		var tabs []*tab
+		for _, tid := range a.GetTabIds() {
+			w, t := s.findTab(tid)
+			w.tabs = slices.DeleteFunc(w.tabs, func(other *tab) bool { return other == t })
+			tabs = append(tabs, t)
+		}
+		target.tabs = append(tabs, target.tabs...)
+	}
+	// close the windows left without tabs only now, as a later assignment may give them tabs again
+	for _, w := range slices.Clone(s.windows) {
+		if len(w.tabs) == 0 {
+			s.removeWindowLocked(w)
+		} else if !slices.ContainsFunc(w.tabs, func(t *tab) bool { return t.id == w.selected }) {
+			w.selected = w.tabs[0].id
+		}
+	}
+	s.emitLayoutLocked()
+	s.emitFocusLocked()
+	return status(api.ReorderTabsResponse_OK)
+}
+
+func (s *Server) activateLocked(req *api.ActivateRequest) *api.ActivateResponse {
+	switch id := req.Identifier.(type) {
+	case *api.ActivateRequest_WindowId:
+		w := s.findWindow(id.WindowId)
+		if w == nil {
+			return &api.ActivateResponse{Status: api.ActivateResponse_BAD_IDENTIFIER.Enum()}
+		}
+		if req.GetOrderWindowFront() {
+			s.activeWindow = w.id
+		}
+	case *api.ActivateRequest_TabId:
+		w, t := s.findTab(id.TabId)
+		if t == nil {
+			return &api.ActivateResponse{Status: api.ActivateResponse_BAD_IDENTIFIER.Enum()}
+		}
+		if req.GetSelectTab() {
+			w.selected = t.id
+		}
+		if req.GetOrderWindowFront() {
+			s.activeWindow = w.id
+		}
+	case *api.ActivateRequest_SessionId:
+		sess := s.resolveSession(id.SessionId)
+		if sess == nil {
+			return &api.ActivateResponse{Status: api.ActivateResponse_BAD_IDENTIFIER.Enum()}
+		}
+		w, t, _ := s.locateSession(sess.id)
+		if t == nil {
+			return &api.ActivateResponse{Status: api.ActivateResponse_BAD_IDENTIFIER.Enum()}
+		}
+		t.active = sess.id
+		if req.GetSelectTab() {
+			w.selected = t.id
+		}
+		if req.GetOrderWindowFront() {
+			s.activeWindow = w.id
+		}
+	}
+	s.emitFocusLocked()
+	return &api.ActivateResponse{Status: api.ActivateResponse_OK.Enum()}
+}
+
+func (s *Server) variableLocked(req *api.VariableRequest) *api.VariableResponse {
+	var vars map[string]string
+	var builtin map[string]string
+	scope := api.VariableScope_APP
+	var identifier string
+	switch sc := req.Scope.(type) {
+	case *api.VariableRequest_SessionId:
+		sess := s.resolveSession(sc.SessionId)
+		if sess == nil {
+			return &api.VariableResponse{Status: api.VariableResponse_SESSION_NOT_FOUND.Enum()}
+		}
+		vars, scope, identifier = sess.vars, api.VariableScope_SESSION, sess.id
+		builtin = map[string]string{"id": jsonString(sess.id), "name": jsonString(sess.name)}
+	case *api.VariableRequest_TabId:
+		_, t := s.findTab(sc.TabId)
+		if t == nil {
+			return &api.VariableResponse{Status: api.VariableResponse_TAB_NOT_FOUND.Enum()}
+		}
+		vars, scope, identifier = t.vars, api.VariableScope_TAB, t.id
+		builtin = map[string]string{"id": jsonString(t.id), "title": jsonString(t.title)}
+	case *api.VariableRequest_WindowId:
+		w := s.findWindow(sc.WindowId)
+		if w == nil {
+			return &api.VariableResponse{Status: api.VariableResponse_WINDOW_NOT_FOUND.Enum()}
+		}
+		vars, scope, identifier = w.vars, api.VariableScope_WINDOW, w.id
+		builtin = map[string]string{"id": jsonString(w.id), "number": strconv.Itoa(w.number)}
+	case *api.VariableRequest_App:
+		vars = s.appVars
+	default:
+		return &api.VariableResponse{Status: api.VariableResponse_MISSING_SCOPE.Enum()}
+	}
+
+	for _, set := range req.GetSet() {
+		if !strings.HasPrefix(set.GetName(), "user.") {
+			return &api.VariableResponse{Status: api.VariableResponse_INVALID_NAME.Enum()}
+		}
+	}
+	for _, set := range req.GetSet() {
+		vars[set.GetName()] = set.GetValue()
+		s.emitVariableLocked(scope, identifier, set.GetName(), set.GetValue())
+	}
+
+	resp := &api.VariableResponse{Status: api.VariableResponse_OK.Enum()}
+	for _, name := range req.GetGet() {
+		if name == "*" {
+			all := make(map[string]json.RawMessage)
+			for k, v := range builtin {
+				all[k] = json.RawMessage(v)
+			}
+			for k, v := range vars {
+				all[k] = json.RawMessage(v)
+			}
+			b, _ := json.Marshal(all)
+			resp.Values = append(resp.Values, string(b))
+			continue
+		}
+		value, ok := vars[name]
+		if !ok {
+			value, ok = builtin[name]
+		}
+		if !ok {
+			value = "null"
+		}
+		resp.Values = append(resp.Values, value)
+	}
+	return resp
+}
+
+func (s *Server) sendTextLocked(req *api.SendTextRequest) *api.SendTextResponse {
+	sess := s.resolveSession(req.GetSession())
+	if sess == nil {
+		return &api.SendTextResponse{Status: api.SendTextResponse_SESSION_NOT_FOUND.Enum()}
+	}
+	sess.input = append(sess.input, req.GetText()...)
+	return &api.SendTextResponse{Status: api.SendTextResponse_OK.Enum()}
+}
+
+func (s *Server) injectLocked(req *api.InjectRequest) *api.InjectResponse {
+	resp := &api.InjectResponse{}
+	for _, sid := range req.GetSessionId() {
+		sess := s.resolveSession(sid)
+		if sess == nil {
+			resp.Status = append(resp.Status, api.InjectResponse_SESSION_NOT_FOUND)
+			continue
+		}
+		sess.output = append(sess.output, req.GetData()...)
+		resp.Status = append(resp.Status, api.InjectResponse_OK)
+		s.emitLocked(&api.Notification{ScreenUpdateNotification: &api.ScreenUpdateNotification{Session: proto.String(sess.id)}})
+	}
+	return resp
+}
+
+func (s *Server) getBufferLocked(req *api.GetBufferRequest) *api.GetBufferResponse {
+	sess := s.resolveSession(req.GetSession())
+	if sess == nil {
+		return &api.GetBufferResponse{Status: api.GetBufferResponse_SESSION_NOT_FOUND.Enum()}
+	}
+	lines := strings.Split(strings.ReplaceAll(string(sess.output), "\r\n", "\n"), "\n")
+	if n := int(req.GetLineRange().GetTrailingLines()); n > 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	resp := &api.GetBufferResponse{Status: api.GetBufferResponse_OK.Enum()}
+	for _, line := range lines {
+		resp.Contents = append(resp.Contents, &api.LineContents{Text: proto.String(line)})
+	}
+	return resp
+}
+
+// jsonFrame is the JSON value of the frame property of windows
+type jsonFrame struct {
+	Origin struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	} `json:"origin"`
+	Size jsonSize `json:"size"`
+}
+
+// jsonSize is the JSON value of a size, such as the grid_size property of sessions
+type jsonSize struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (s *Server) getPropertyLocked(req *api.GetPropertyRequest) *api.GetPropertyResponse {
+	var value any
+	switch id := req.Identifier.(type) {
+	case *api.GetPropertyRequest_WindowId:
+		w := s.findWindow(id.WindowId)
+		if w == nil {
+			return &api.GetPropertyResponse{Status: api.GetPropertyResponse_INVALID_TARGET.Enum()}
+		}
+		switch req.GetName() {
+		case "frame":
+			var frame jsonFrame
+			frame.Origin.X, frame.Origin.Y = float64(w.frame.GetOrigin().GetX()), float64(w.frame.GetOrigin().GetY())
+			frame.Size.Width, frame.Size.Height = float64(w.frame.GetSize().GetWidth()), float64(w.frame.GetSize().GetHeight())
+			value = frame
+		case "fullscreen":
+			value = w.fullscreen
+		default:
+			return &api.GetPropertyResponse{Status: api.GetPropertyResponse_UNRECOGNIZED_NAME.Enum()}
+		}
+	case *api.GetPropertyRequest_SessionId:
+		sess := s.resolveSession(id.SessionId)
+		if sess == nil {
+			return &api.GetPropertyResponse{Status: api.GetPropertyResponse_INVALID_TARGET.Enum()}
+		}
+		switch req.GetName() {
+		case "grid_size":
+			value = jsonSize{Width: float64(sess.columns), Height: float64(sess.rows)}
+		case "buried":
+			value = slices.Contains(s.buried, sess)
+		case "number_of_lines":
+			lines := strings.Count(strings.ReplaceAll(string(sess.output), "\r\n", "\n"), "\n") + 1
+			value = map[string]int{"overflow": 0, "grid": sess.rows, "history": max(lines-sess.rows, 0)}
+		default:
+			return &api.GetPropertyResponse{Status: api.GetPropertyResponse_UNRECOGNIZED_NAME.Enum()}
+		}
+	default:
+		return &api.GetPropertyResponse{Status: api.GetPropertyResponse_INVALID_TARGET.Enum()}
+	}
+	b, _ := json.Marshal(value)
+	return &api.GetPropertyResponse{Status: api.GetPropertyResponse_OK.Enum(), JsonValue: proto.String(string(b))}
+}
+
+func (s *Server) setPropertyLocked(req *api.SetPropertyRequest) *api.SetPropertyResponse {
+	status := func(status api.SetPropertyResponse_Status) *api.SetPropertyResponse {
+		return &api.SetPropertyResponse{Status: status.Enum()}
+	}
+	switch id := req.Identifier.(type) {
+	case *api.SetPropertyRequest_WindowId:
+		w := s.findWindow(id.WindowId)
+		if w == nil {
+			return status(api.SetPropertyResponse_INVALID_TARGET)
+		}
+		switch req.GetName() {
+		case "frame":
+			var frame jsonFrame
+			if err := json.Unmarshal([]byte(req.GetJsonValue()), &frame); err != nil {
+				return status(api.SetPropertyResponse_INVALID_VALUE)
+			}
+			if w.fullscreen {
+				return status(api.SetPropertyResponse_IMPOSSIBLE)
+			}
+			w.frame = &api.Frame{
+				Origin: &api.Point{X: proto.Int32(int32(frame.Origin.X)), Y: proto.Int32(int32(frame.Origin.Y))},
+				Size:   &api.Size{Width: proto.Int32(int32(frame.Size.Width)), Height: proto.Int32(int32(frame.Size.Height))},
+			}
+		case "fullscreen":
+			if err := json.Unmarshal([]byte(req.GetJsonValue()), &w.fullscreen); err != nil {
+				return status(api.SetPropertyResponse_INVALID_VALUE)
+			}
+		default:
+			return status(api.SetPropertyResponse_UNRECOGNIZED_NAME)
+		}
+	case *api.SetPropertyRequest_SessionId:
+		sess := s.resolveSession(id.SessionId)
+		if sess == nil {
+			return status(api.SetPropertyResponse_INVALID_TARGET)
+		}
+		switch req.GetName() {
+		case "grid_size":
+			var size jsonSize
+			if err := json.Unmarshal([]byte(req.GetJsonValue()), &size); err != nil || size.Width < 1 || size.Height < 1 {
+				return status(api.SetPropertyResponse_INVALID_VALUE)
+			}
+			if w, _, _ := s.locateSession(sess.id); w != nil && w.fullscreen {
+				return status(api.SetPropertyResponse_IMPOSSIBLE)
+			}
+			sess.columns, sess.rows = int(size.Width), int(size.Height)
+		case "buried":
+			var buried bool
+			if err := json.Unmarshal([]byte(req.GetJsonValue()), &buried); err != nil {
+				return status(api.SetPropertyResponse_INVALID_VALUE)
+			}
+			s.setBuriedLocked(sess, buried)
+		default:
+			return status(api.SetPropertyResponse_UNRECOGNIZED_NAME)
+		}
+	default:
+		return status(api.SetPropertyResponse_INVALID_TARGET)
+	}
+	s.emitLayoutLocked()
+	return status(api.SetPropertyResponse_OK)
+}
+
+// setBuriedLocked hides the session from its tab, or shows it again in a new window
+func (s *Server) setBuriedLocked(sess *session, buried bool) {
+	i := slices.Index(s.buried, sess)
+	switch {
+	case buried && i < 0:
+		s.detachSessionLocked(sess.id)
+		s.buried = append(s.buried, sess)
+	case !buried && i >= 0:
+		s.buried = slices.Delete(s.buried, i, i+1)
+		s.addTabLocked(s.newWindowLocked(), -1, sess)
+		s.emitFocusLocked()
+	}
+}
+
+var invocationRegexp = regexp.MustCompile(`^iterm2\.(\w+)\((.*)\)$`)
+
+func (s *Server) invokeFunctionLocked(req *api.InvokeFunctionRequest) *api.InvokeFunctionResponse {
+	fail := func(status api.InvokeFunctionResponse_Status, format string, a ...any) *api.InvokeFunctionResponse {
+		return &api.InvokeFunctionResponse{Disposition: &api.InvokeFunctionResponse_Error_{
+			Error: &api.InvokeFunctionResponse_Error{Status: status.Enum(), ErrorReason: proto.String(fmt.Sprintf(format, a...))},
+		}}
+	}
+	m := invocationRegexp.FindStringSubmatch(req.GetInvocation())
+	if m == nil {
+		return fail(api.InvokeFunctionResponse_REQUEST_MALFORMED, "malformed invocation: %s", req.GetInvocation())
+	}
+	args, err := parseArguments(m[2])
+	if err != nil {
+		return fail(api.InvokeFunctionResponse_REQUEST_MALFORMED, "%v", err)
+	}
+	receiver := req.GetMethod().GetReceiver()
+	w := s.findWindow(receiver)
+	_, t := s.findTab(receiver)
+	sess := s.resolveSession(receiver)
+	if w == nil && t == nil && sess == nil {
+		return fail(api.InvokeFunctionResponse_INVALID_ID, "no such receiver: %s", receiver)
+	}
+
+	switch {
+	case m[1] == "set_title" && w != nil:
+		w.title = args["title"]
+	case m[1] == "set_title" && t != nil:
+		t.title = args["title"]
+	case m[1] == "set_name" && sess != nil:
+		sess.name = args["name"]
+		s.emitLayoutLocked()
+	case m[1] == "run_tmux_command" && sess != nil:
+		return fail(api.InvokeFunctionResponse_FAILED, "not a tmux integration session")
+	default:
+		return fail(api.InvokeFunctionResponse_FAILED, "unknown function %s for receiver %s", m[1], receiver)
+	}
+	return &api.InvokeFunctionResponse{Disposition: &api.InvokeFunctionResponse_Success_{
+		Success: &api.InvokeFunctionResponse_Success{JsonResult: proto.String("null")},
+	}}
+}
+
+// parseArguments parses the `name: "value"` string arguments of an invocation
+func parseArguments(s string) (map[string]string, error) {
+	args := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), ",")) {
+		name, rest, ok := strings.Cut(s, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed argument: %s", s)
+		}
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, `"`) {
+			return nil, fmt.Errorf("unsupported argument value: %s", rest)
+		}
+		end := 1
+		for ; end < len(rest) && rest[end] != '"'; end++ {
+			if rest[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(rest) {
+			return nil, fmt.Errorf("unterminated string: %s", rest)
+		}
+		value, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed string %s: %w", rest[:end+1], err)
+		}
+		args[strings.TrimSpace(name)] = value
+		s = rest[end+1:]
+	}
+	return args, nil
+}
+
+func (s *Server) tmuxLocked(req *api.TmuxRequest) *api.TmuxResponse {
+	if req.GetListConnections() == nil {
+		return &api.TmuxResponse{Status: api.TmuxResponse_INVALID_REQUEST.Enum()}
+	}
+	list := &api.TmuxResponse_ListConnections{}
+	seen := make(map[string]bool)
+	for _, w := range s.windows {
+		for _, t := range w.tabs {
+			if t.tmuxConnectionID == "" || seen[t.tmuxConnectionID] {
+				continue
+			}
+			seen[t.tmuxConnectionID] = true
+			list.Connections = append(list.Connections, &api.TmuxResponse_ListConnections_Connection{
+				ConnectionId:    proto.String(t.tmuxConnectionID),
+				OwningSessionId: proto.String(s.tmuxOwners[t.tmuxConnectionID]),
+			})
+		}
+	}
+	return &api.TmuxResponse{
+		Status:  api.TmuxResponse_OK.Enum(),
+		Payload: &api.TmuxResponse_ListConnections_{ListConnections: list},
+	}
+}
+
+func (s *Server) notificationLocked(sc *serverConn, req *api.NotificationRequest) *api.NotificationResponse {
+	switch req.GetNotificationType() {
+	case api.NotificationType_NOTIFY_ON_KEYSTROKE, api.NotificationType_NOTIFY_ON_SCREEN_UPDATE,
+		api.NotificationType_NOTIFY_ON_PROMPT, api.NotificationType_NOTIFY_ON_CUSTOM_ESCAPE_SEQUENCE:
+		switch sid := req.GetSession(); sid {
+		case "", "all", "active":
+		default:
+			if s.sessions[sid] == nil {
+				return &api.NotificationResponse{Status: api.NotificationResponse_SESSION_NOT_FOUND.Enum()}
+			}
+		}
+	case api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE:
+		if req.GetVariableMonitorRequest() == nil {
+			return &api.NotificationResponse{Status: api.NotificationResponse_REQUEST_MALFORMED.Enum()}
+		}
+	case api.NotificationType_NOTIFY_ON_SERVER_ORIGINATED_RPC:
+		if req.GetRpcRegistrationRequest() == nil {
+			return &api.NotificationResponse{Status: api.NotificationResponse_REQUEST_MALFORMED.Enum()}
+		}
+	}
+
+	key := subscriptionKey(req)
+	_, subscribed := sc.subs[key]
+	switch {
+	case req.GetSubscribe() && subscribed:
+		return &api.NotificationResponse{Status: api.NotificationResponse_ALREADY_SUBSCRIBED.Enum()}
+	case !req.GetSubscribe() && !subscribed:
+		return &api.NotificationResponse{Status: api.NotificationResponse_NOT_SUBSCRIBED.Enum()}
+	case req.GetSubscribe():
+		sc.subs[key] = proto.Clone(req).(*api.NotificationRequest)
+	default:
+		delete(sc.subs, key)
+	}
+	return &api.NotificationResponse{Status: api.NotificationResponse_OK.Enum()}
+}
+
+func (s *Server) emitLayoutLocked() {
+	s.emitLocked(&api.Notification{LayoutChangedNotification: &api.LayoutChangedNotification{
+		ListSessionsResponse: s.listSessionsLocked(),
+	}})
+}
+
+func (s *Server) emitFocusLocked() {
+	for _, n := range s.focusLocked() {
+		s.emitLocked(&api.Notification{FocusChangedNotification: n})
+	}
+}
+
+func (s *Server) emitVariableLocked(scope api.VariableScope, identifier, name, value string) {
+	n := &api.VariableChangedNotification{
+		Scope:        scope.Enum(),
+		Name:         proto.String(name),
+		JsonNewValue: proto.String(value),
+	}
+	if scope != api.VariableScope_APP {
+		n.Identifier = proto.String(identifier)
+	}
+	s.emitLocked(&api.Notification{VariableChangedNotification: n})
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
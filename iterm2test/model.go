@@ -0,0 +1,322 @@
+package iterm2test
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultColumns = 80
+	defaultRows    = 25
+	cellWidth      = 7
+	cellHeight     = 16
+)
+
+type window struct {
+	id     string
+	number int
+	title  string
+	frame  *api.Frame
+	tabs   []*tab
+	vars   map[string]string
+	// fullscreen windows cannot be moved or resized
+	fullscreen bool
+	// selected is the id of the selected tab
+	selected string
+}
+
+type tab struct {
+	id               string
+	title            string
+	root             *node
+	tmuxWindowID     string
+	tmuxConnectionID string
+	vars             map[string]string
+	// active is the id of the active session
+	active string
+}
+
+// node is a split tree node, holding either a session or child nodes
+type node struct {
+	vertical bool
+	children []*node
+	session  *session
+	parent   *node
+}
+
+type session struct {
+	id      string
+	name    string
+	columns int
+	rows    int
+	vars    map[string]string
+	input   []byte
+	output  []byte
+	// busy sessions run a job, closing them needs force
+	busy bool
+	// exited sessions stay open after their job ended, until restarted
+	exited bool
+}
+
+func (s *Server) newWindowLocked() *window {
+	s.nextWindow++
+	w := &window{
+		id:     fmt.Sprintf("pty-%08X-0000-4000-8000-%012X", s.nextWindow, s.nextWindow),
+		number: s.nextWindow - 1,
+		frame: &api.Frame{
+			Origin: &api.Point{X: proto.Int32(0), Y: proto.Int32(0)},
+			Size:   &api.Size{Width: proto.Int32(defaultColumns * cellWidth), Height: proto.Int32(defaultRows * cellHeight)},
+		},
+		vars: make(map[string]string),
+	}
+	s.windows = append(s.windows, w)
+	return w
+}
+
+func (s *Server) newTabLocked(w *window, index int) *tab {
+	return s.addTabLocked(w, index, s.newSessionLocked())
+}
+
+// addTabLocked inserts a new tab holding sess into w
+func (s *Server) addTabLocked(w *window, index int, sess *session) *tab {
+	s.nextTab++
+	t := &tab{
+		id:   strconv.Itoa(s.nextTab),
+		vars: make(map[string]string),
+	}
+	t.root = &node{children: []*node{{session: sess}}}
+	t.root.children[0].parent = t.root
+	t.active = sess.id
+	if index < 0 || index > len(w.tabs) {
+		index = len(w.tabs)
+	}
+	w.tabs = slices.Insert(w.tabs, index, t)
+	w.selected = t.id
+	s.activeWindow = w.id
+	return t
+}
+
+func (s *Server) newSessionLocked() *session {
+	s.nextSession++
+	sess := &session{
+		id:      fmt.Sprintf("%08X-0000-4000-8000-%012X", s.nextSession, s.nextSession),
+		name:    "Shell",
+		columns: defaultColumns,
+		rows:    defaultRows,
+		vars:    make(map[string]string),
+	}
+	s.sessions[sess.id] = sess
+	return sess
+}
+
+// locateSession returns the window, tab and tree node holding the session
+func (s *Server) locateSession(sid string) (*window, *tab, *node) {
+	for _, w := range s.windows {
+		for _, t := range w.tabs {
+			if n := t.root.find(sid); n != nil {
+				return w, t, n
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+func (s *Server) findWindow(wid string) *window {
+	for _, w := range s.windows {
+		if w.id == wid {
+			return w
+		}
+	}
+	return nil
+}
+
+func (s *Server) findTab(tid string) (*window, *tab) {
+	for _, w := range s.windows {
+		for _, t := range w.tabs {
+			if t.id == tid {
+				return w, t
+			}
+		}
+	}
+	return nil, nil
+}
+
+// resolveSession maps a session id from a request, which may be "active", to a session
+func (s *Server) resolveSession(sid string) *session {
+	if sid == "active" {
+		w := s.findWindow(s.activeWindow)
+		if w == nil {
+			return nil
+		}
+		for _, t := range w.tabs {
+			if t.id == w.selected {
+				return s.sessions[t.active]
+			}
+		}
+		return nil
+	}
+	return s.sessions[sid]
+}
+
+func (n *node) find(sid string) *node {
+	if n.session != nil {
+		if n.session.id == sid {
+			return n
+		}
+		return nil
+	}
+	for _, child := range n.children {
+		if found := child.find(sid); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (n *node) sessions() []*session {
+	if n.session != nil {
+		return []*session{n.session}
+	}
+	var list []*session
+	for _, child := range n.children {
+		list = append(list, child.sessions()...)
+	}
+	return list
+}
+
+// split inserts a new session next to the leaf n
+func (n *node) split(sess *session, vertical, before bool) {
+	leaf := &node{session: sess}
+	parent := n.parent
+	if parent.vertical != vertical && len(parent.children) > 1 {
+		// wrap the leaf into a new node with the requested orientation
+		n.children = []*node{{session: n.session, parent: n}}
+		n.session = nil
+		n.vertical = vertical
+		parent = n
+		n = n.children[0]
+	}
+	parent.vertical = vertical
+	leaf.parent = parent
+	index := slices.Index(parent.children, n)
+	if !before {
+		index++
+	}
+	parent.children = slices.Insert(parent.children, index, leaf)
+	if vertical {
+		n.session.columns = max(n.session.columns/2, 1)
+		sess.columns = n.session.columns
+		sess.rows = n.session.rows
+	} else {
+		n.session.rows = max(n.session.rows/2, 1)
+		sess.rows = n.session.rows
+		sess.columns = n.session.columns
+	}
+}
+
+// remove deletes the leaf n, collapsing nodes left with a single child
+func (n *node) remove() {
+	parent := n.parent
+	parent.children = slices.DeleteFunc(parent.children, func(child *node) bool { return child == n })
+	if len(parent.children) == 1 && parent.parent != nil {
+		only := parent.children[0]
+		parent.vertical = only.vertical
+		parent.session = only.session
+		parent.children = only.children
+		for _, child := range parent.children {
+			child.parent = parent
+		}
+	}
+}
+
+func (s *Server) listSessionsLocked() *api.ListSessionsResponse {
+	resp := &api.ListSessionsResponse{}
+	for _, w := range s.windows {
+		lw := &api.ListSessionsResponse_Window{
+			WindowId: proto.String(w.id),
+			Frame:    proto.Clone(w.frame).(*api.Frame),
+			Number:   proto.Int32(int32(w.number)),
+		}
+		for _, t := range w.tabs {
+			lt := &api.ListSessionsResponse_Tab{
+				TabId: proto.String(t.id),
+				Root:  t.root.summary(),
+			}
+			if t.tmuxWindowID != "" {
+				lt.TmuxWindowId = proto.String(t.tmuxWindowID)
+				lt.TmuxConnectionId = proto.String(t.tmuxConnectionID)
+			}
+			lw.Tabs = append(lw.Tabs, lt)
+		}
+		resp.Windows = append(resp.Windows, lw)
+	}
+	for _, sess := range s.buried {
+		resp.BuriedSessions = append(resp.BuriedSessions, &api.SessionSummary{
+			UniqueIdentifier: proto.String(sess.id),
+			Title:            proto.String(sess.name),
+		})
+	}
+	return resp
+}
+
+func (n *node) summary() *api.SplitTreeNode {
+	tree := &api.SplitTreeNode{Vertical: proto.Bool(n.vertical)}
+	for _, child := range n.children {
+		if child.session != nil {
+			tree.Links = append(tree.Links, &api.SplitTreeNode_SplitTreeLink{
+				Child: &api.SplitTreeNode_SplitTreeLink_Session{Session: child.session.summary()},
+			})
+		} else {
+			tree.Links = append(tree.Links, &api.SplitTreeNode_SplitTreeLink{
+				Child: &api.SplitTreeNode_SplitTreeLink_Node{Node: child.summary()},
+			})
+		}
+	}
+	return tree
+}
+
+func (sess *session) summary() *api.SessionSummary {
+	return &api.SessionSummary{
+		UniqueIdentifier: proto.String(sess.id),
+		Title:            proto.String(sess.name),
+		GridSize:         &api.Size{Width: proto.Int32(int32(sess.columns)), Height: proto.Int32(int32(sess.rows))},
+		Frame: &api.Frame{
+			Origin: &api.Point{X: proto.Int32(0), Y: proto.Int32(0)},
+			Size:   &api.Size{Width: proto.Int32(int32(sess.columns * cellWidth)), Height: proto.Int32(int32(sess.rows * cellHeight))},
+		},
+	}
+}
+
+// focusLocked describes the focus state the way FocusResponse does
+func (s *Server) focusLocked() []*api.FocusChangedNotification {
+	list := []*api.FocusChangedNotification{{
+		Event: &api.FocusChangedNotification_ApplicationActive{ApplicationActive: true},
+	}}
+	for _, w := range s.windows {
+		status := api.FocusChangedNotification_Window_TERMINAL_WINDOW_RESIGNED_KEY
+		if w.id == s.activeWindow {
+			status = api.FocusChangedNotification_Window_TERMINAL_WINDOW_BECAME_KEY
+		}
+		list = append(list, &api.FocusChangedNotification{
+			Event: &api.FocusChangedNotification_Window_{Window: &api.FocusChangedNotification_Window{
+				WindowStatus: status.Enum(),
+				WindowId:     proto.String(w.id),
+			}},
+		})
+		if w.selected != "" {
+			list = append(list, &api.FocusChangedNotification{
+				Event: &api.FocusChangedNotification_SelectedTab{SelectedTab: w.selected},
+			})
+		}
+		for _, t := range w.tabs {
+			list = append(list, &api.FocusChangedNotification{
+				Event: &api.FocusChangedNotification_Session{Session: t.active},
+			})
+		}
+	}
+	return list
+}
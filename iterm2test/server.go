@@ -0,0 +1,301 @@
+// Package iterm2test provides an in-process stand-in for iTerm2, so that code
+// using the iterm2 package can be tested without iTerm2, e.g. on Linux CI.
+//
+// The Server speaks the api.iterm2.com websocket subprotocol on a temporary
+// unix socket and keeps an in-memory model of windows, tabs, split panes,
+// variables and session buffers.
+package iterm2test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+	"google.golang.org/protobuf/proto"
+)
+
+// Cookie is the only cookie the Server accepts
+const Cookie = "iterm2test-cookie"
+
+// ProtocolVersion is the API protocol version the Server announces by default
+const ProtocolVersion = "1.10"
+
+// HandlerFunc answers a request instead of the built-in model.
+// Returning nil lets the built-in model answer it.
+type HandlerFunc func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage
+
+// Server is a fake iTerm2 listening on a temporary unix socket
+type Server struct {
+	dir  string
+	path string
+	ln   net.Listener
+	srv  *http.Server
+
+	mu           sync.Mutex
+	conns        map[*serverConn]struct{}
+	handler      HandlerFunc
+	version      string
+	windows      []*window
+	sessions     map[string]*session
+	buried       []*session
+	appVars      map[string]string
+	menuItems    []string
+	tmuxOwners   map[string]string
+	pending      []*api.Notification
+	activeWindow string
+	nextWindow   int
+	nextTab      int
+	nextSession  int
+}
+
+// serverConn is one client connection and its notification subscriptions
+type serverConn struct {
+	ws          *websocket.Conn
+	wmu         sync.Mutex
+	subs        map[string]*api.NotificationRequest
+	transaction bool
+}
+
+// NewServer starts a fake iTerm2 without any window.
+// Close it to remove the socket.
+func NewServer() (*Server, error) {
+	dir, err := os.MkdirTemp("", "iterm2test")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "socket")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	s := &Server{
+		dir:        dir,
+		path:       path,
+		ln:         ln,
+		conns:      make(map[*serverConn]struct{}),
+		version:    ProtocolVersion,
+		sessions:   make(map[string]*session),
+		appVars:    make(map[string]string),
+		tmuxOwners: make(map[string]string),
+	}
+	s.srv = &http.Server{Handler: http.HandlerFunc(s.serveHTTP)}
+	go func() { _ = s.srv.Serve(ln) }()
+	return s, nil
+}
+
+// SocketPath returns the path of the unix socket the server listens on
+func (s *Server) SocketPath() string {
+	return s.path
+}
+
+// Options returns client options that connect to this server
+func (s *Server) Options() client.Options {
+	return client.Options{
+		SocketPath:  s.path,
+		Credentials: []client.CredentialProvider{client.StaticCredentials{Cookie: Cookie}},
+	}
+}
+
+// NewApp connects a new iterm2.App to this server
+func (s *Server) NewApp(name string) (*iterm2.App, error) {
+	return iterm2.NewAppWithOptions(name, s.Options())
+}
+
+// Close stops the server, disconnects every client and removes the socket
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	s.DropConnections()
+	_ = os.RemoveAll(s.dir)
+	return err
+}
+
+// DropConnections closes every client connection, as if iTerm2 had quit
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sc := range s.conns {
+		_ = sc.ws.Close()
+		delete(s.conns, sc)
+	}
+}
+
+// Handle installs fn to answer requests before the built-in model does,
+// e.g. to inject errors. Pass nil to remove it. fn is called without any
+// lock held, so it may call the other methods of the Server.
+func (s *Server) Handle(fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = fn
+}
+
+// SetProtocolVersion changes the API protocol version announced to the next
+// connections, e.g. "1.2" to test features missing in older iTerm2 versions.
+// An empty version announces none.
+func (s *Server) SetProtocolVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// Notify sends n to every connection subscribed to its notification type
+func (s *Server) Notify(n *api.Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emitLocked(n)
+	s.flushLocked()
+}
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{"api.iterm2.com"},
+	CheckOrigin:  func(*http.Request) bool { return true },
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-iterm2-cookie") != Cookie {
+		http.Error(w, "Unauthorized: bad cookie", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	header := http.Header{}
+	if s.version != "" {
+		header.Set("X-iTerm2-Protocol-Version", s.version)
+	}
+	s.mu.Unlock()
+	ws, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return
+	}
+	sc := &serverConn{ws: ws, subs: make(map[string]*api.NotificationRequest)}
+	s.mu.Lock()
+	s.conns[sc] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, sc)
+		s.mu.Unlock()
+		_ = ws.Close()
+	}()
+
+	for {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req api.ClientOriginatedMessage
+		if err := proto.Unmarshal(msg, &req); err != nil {
+			return
+		}
+		s.mu.Lock()
+		handler := s.handler
+		s.mu.Unlock()
+		var resp *api.ServerOriginatedMessage
+		if handler != nil {
+			resp = handler(&req)
+		}
+		s.mu.Lock()
+		if resp == nil {
+			resp = s.handleLocked(sc, &req)
+		}
+		resp.Id = req.Id
+		err = sc.send(resp)
+		s.flushLocked()
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sc *serverConn) send(msg *api.ServerOriginatedMessage) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	return sc.ws.WriteMessage(websocket.BinaryMessage, b)
+}
+
+// emitLocked queues n for the subscribed connections. Notifications caused by
+// a request are sent after its response by flushLocked.
+func (s *Server) emitLocked(n *api.Notification) {
+	s.pending = append(s.pending, n)
+}
+
+func (s *Server) flushLocked() {
+	for _, n := range s.pending {
+		msg := &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_Notification{Notification: n},
+		}
+		for sc := range s.conns {
+			for _, req := range sc.subs {
+				if matchSubscription(req, n) {
+					_ = sc.send(msg)
+					break
+				}
+			}
+		}
+	}
+	s.pending = nil
+}
+
+func subscriptionKey(req *api.NotificationRequest) string {
+	req = proto.Clone(req).(*api.NotificationRequest)
+	req.Subscribe = nil
+	b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	return string(b)
+}
+
+func matchSubscription(req *api.NotificationRequest, n *api.Notification) bool {
+	session := func(sid string) bool {
+		switch req.GetSession() {
+		case "", "all", "active":
+			return true
+		}
+		return req.GetSession() == sid
+	}
+	switch req.GetNotificationType() {
+	case api.NotificationType_NOTIFY_ON_KEYSTROKE:
+		return n.KeystrokeNotification != nil && session(n.GetKeystrokeNotification().GetSession())
+	case api.NotificationType_NOTIFY_ON_SCREEN_UPDATE:
+		return n.ScreenUpdateNotification != nil && session(n.GetScreenUpdateNotification().GetSession())
+	case api.NotificationType_NOTIFY_ON_PROMPT:
+		return n.PromptNotification != nil && session(n.GetPromptNotification().GetSession())
+	case api.NotificationType_NOTIFY_ON_CUSTOM_ESCAPE_SEQUENCE:
+		return n.CustomEscapeSequenceNotification != nil && session(n.GetCustomEscapeSequenceNotification().GetSession())
+	case api.NotificationType_NOTIFY_ON_NEW_SESSION:
+		return n.NewSessionNotification != nil
+	case api.NotificationType_NOTIFY_ON_TERMINATE_SESSION:
+		return n.TerminateSessionNotification != nil
+	case api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE:
+		return n.LayoutChangedNotification != nil
+	case api.NotificationType_NOTIFY_ON_FOCUS_CHANGE:
+		return n.FocusChangedNotification != nil
+	case api.NotificationType_NOTIFY_ON_BROADCAST_CHANGE:
+		return n.BroadcastDomainsChanged != nil
+	case api.NotificationType_NOTIFY_ON_SERVER_ORIGINATED_RPC:
+		return n.ServerOriginatedRpcNotification != nil &&
+			n.GetServerOriginatedRpcNotification().GetRpc().GetName() == req.GetRpcRegistrationRequest().GetName()
+	case api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE:
+		vc, vm := n.GetVariableChangedNotification(), req.GetVariableMonitorRequest()
+		return vc != nil && vc.GetScope() == vm.GetScope() && vc.GetName() == vm.GetName() &&
+			(vm.GetIdentifier() == "" || vm.GetIdentifier() == "all" || vm.GetIdentifier() == vc.GetIdentifier())
+	case api.NotificationType_NOTIFY_ON_PROFILE_CHANGE:
+		return n.ProfileChangedNotification != nil
+	}
+	return false
+}
+
+func errorMessage(format string, a ...any) *api.ServerOriginatedMessage {
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_Error{Error: fmt.Sprintf(format, a...)},
+	}
+}
@@ -0,0 +1,175 @@
+package iterm2test_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+	"github.com/trzsz/iterm2/iterm2test"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestServer(t *testing.T) (*iterm2test.Server, *iterm2.App) {
+	t.Helper()
+	srv, err := iterm2test.NewServer()
+	if err != nil {
+		t.Fatalf("start server failed: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	app, err := srv.NewApp("test")
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = app.Close() })
+	return srv, app
+}
+
+func TestBadCookie(t *testing.T) {
+	srv, _ := newTestServer(t)
+	opts := srv.Options()
+	opts.Credentials = []client.CredentialProvider{client.StaticCredentials{Cookie: "bad"}}
+	if _, err := iterm2.NewAppWithOptions("test", opts); err == nil {
+		t.Fatal("a bad cookie should be refused")
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	srv, app := newTestServer(t)
+	if got := app.ServerInfo().ProtocolVersion.String(); got != iterm2test.ProtocolVersion {
+		t.Fatalf("protocol version = %v, want %v", got, iterm2test.ProtocolVersion)
+	}
+	srv.SetProtocolVersion("")
+	other, err := srv.NewApp("test")
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer other.Close()
+	if other.ServerInfo().Known {
+		t.Fatal("no protocol version should be announced")
+	}
+}
+
+func TestModel(t *testing.T) {
+	srv, app := newTestServer(t)
+	wid, tid, sid := srv.CreateWindow()
+
+	ls := srv.ListSessions()
+	if len(ls.GetWindows()) != 1 || ls.GetWindows()[0].GetWindowId() != wid {
+		t.Fatalf("windows = %v, want [%v]", ls.GetWindows(), wid)
+	}
+	tabs := ls.GetWindows()[0].GetTabs()
+	if len(tabs) != 1 || tabs[0].GetTabId() != tid {
+		t.Fatalf("tabs = %v, want [%v]", tabs, tid)
+	}
+
+	s, err := app.GetCurrentActiveSession()
+	if err != nil || s.GetSessionID() != sid {
+		t.Fatalf("active session = %v, %v, want %v", s, err, sid)
+	}
+	s2, err := s.SplitPane(iterm2.SplitPaneOptions{Vertical: true})
+	if err != nil {
+		t.Fatalf("split pane failed: %v", err)
+	}
+	layout, err := app.Layout()
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	sessions := layout.Sessions()
+	if len(sessions) != 2 || sessions[1].ID != s2.GetSessionID() || sessions[0].GridSize.Width != 40 {
+		t.Fatalf("sessions = %+v, want two halves", sessions)
+	}
+
+	if !srv.Focus(s2.GetSessionID()) {
+		t.Fatal("focus failed")
+	}
+	if active, err := app.GetCurrentActiveSession(); err != nil || active.GetSessionID() != s2.GetSessionID() {
+		t.Fatalf("active session = %v, %v, want %v", active, err, s2.GetSessionID())
+	}
+
+	srv.TerminateSession(s2.GetSessionID())
+	srv.TerminateSession(sid)
+	if ls := srv.ListSessions(); len(ls.GetWindows()) != 0 {
+		t.Fatalf("windows = %v, want none after the last session terminated", ls.GetWindows())
+	}
+}
+
+func TestSessionIO(t *testing.T) {
+	srv, app := newTestServer(t)
+	_, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	if err := s.SendText("ls\n"); err != nil {
+		t.Fatalf("send text failed: %v", err)
+	}
+	if got := srv.Input(s.GetSessionID()); got != "ls\n" {
+		t.Fatalf("input = %q, want %q", got, "ls\n")
+	}
+	if err := s.Inject([]byte("hello")); err != nil {
+		t.Fatalf("inject failed: %v", err)
+	}
+	if got := srv.Output(s.GetSessionID()); got != "hello" {
+		t.Fatalf("output = %q, want %q", got, "hello")
+	}
+
+	srv.SetVariable(s.GetSessionID(), "user.answer", "42")
+	values, err := s.GetVariable("user.answer", "user.missing")
+	if err != nil || !slices.Equal(values, []string{"42", "null"}) {
+		t.Fatalf("variables = %v, %v, want [42 null]", values, err)
+	}
+
+	if err := s.GetWindow().SetTitle("mine"); err != nil {
+		t.Fatalf("set title failed: %v", err)
+	}
+	if got := srv.Title(s.GetWindowID()); got != "mine" {
+		t.Fatalf("title = %q, want %q", got, "mine")
+	}
+	if err := app.SelectMenuItem("Shell/Close"); err != nil {
+		t.Fatalf("select menu item failed: %v", err)
+	}
+	if got := srv.MenuItems(); !slices.Equal(got, []string{"Shell/Close"}) {
+		t.Fatalf("menu items = %v, want [Shell/Close]", got)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	srv, app := newTestServer(t)
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetCreateTabRequest() == nil {
+			return nil
+		}
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_CreateTabResponse{
+			CreateTabResponse: &api.CreateTabResponse{Status: api.CreateTabResponse_INVALID_PROFILE_NAME.Enum()},
+		}}
+	})
+	if _, _, err := app.CreateWindow(); !errors.Is(err, iterm2.ErrNotFound) {
+		t.Fatalf("create window error = %v, want %v", err, iterm2.ErrNotFound)
+	}
+	srv.Handle(nil)
+	if _, _, err := app.CreateWindow(); err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	srv, app := newTestServer(t)
+	req := &api.NotificationRequest{NotificationType: api.NotificationType_NOTIFY_ON_BROADCAST_CHANGE.Enum()}
+	ch, _, err := app.SubscribeChan(req, 1)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	srv.Notify(&api.Notification{NewSessionNotification: &api.NewSessionNotification{SessionId: proto.String("x")}})
+	srv.Notify(&api.Notification{BroadcastDomainsChanged: &api.BroadcastDomainsChangedNotification{}})
+	select {
+	case n := <-ch:
+		if n.GetBroadcastDomainsChanged() == nil {
+			t.Fatalf("notification = %v, want only the subscribed type", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the notification")
+	}
+}
@@ -0,0 +1,203 @@
+package iterm2test
+
+import (
+	"slices"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// CreateWindow adds a window with one tab and one session, as if the user had opened it.
+// The new window becomes the key window.
+func (s *Server) CreateWindow() (wid, tid, sid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.newWindowLocked()
+	t := s.newTabLocked(w, -1)
+	s.emitLocked(&api.Notification{NewSessionNotification: &api.NewSessionNotification{SessionId: proto.String(t.active)}})
+	s.emitLayoutLocked()
+	s.emitFocusLocked()
+	s.flushLocked()
+	return w.id, t.id, t.active
+}
+
+// TerminateSession removes a session, closing its tab and window when they become empty
+func (s *Server) TerminateSession(sid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.terminateSessionLocked(sid) {
+		return false
+	}
+	s.emitLayoutLocked()
+	s.flushLocked()
+	return true
+}
+
+func (s *Server) terminateSessionLocked(sid string) bool {
+	if i := slices.IndexFunc(s.buried, func(sess *session) bool { return sess.id == sid }); i >= 0 {
+		s.buried = slices.Delete(s.buried, i, i+1)
+	} else if !s.detachSessionLocked(sid) {
+		return false
+	}
+	delete(s.sessions, sid)
+	s.emitLocked(&api.Notification{TerminateSessionNotification: &api.TerminateSessionNotification{SessionId: proto.String(sid)}})
+	return true
+}
+
+// detachSessionLocked removes a session from its split tree, closing its tab and window when they become empty
+func (s *Server) detachSessionLocked(sid string) bool {
+	w, t, n := s.locateSession(sid)
+	if n == nil {
+		return false
+	}
+	n.remove()
+	if remaining := t.root.sessions(); len(remaining) == 0 {
+		s.removeTabLocked(w, t)
+	} else if t.active == sid {
+		t.active = remaining[0].id
+	}
+	return true
+}
+
+// removeTabLocked takes the tab out of the window, closing the window when it becomes empty
+func (s *Server) removeTabLocked(w *window, t *tab) {
+	w.tabs = slices.DeleteFunc(w.tabs, func(other *tab) bool { return other == t })
+	if len(w.tabs) == 0 {
+		s.removeWindowLocked(w)
+	} else if w.selected == t.id {
+		w.selected = w.tabs[0].id
+	}
+}
+
+// removeWindowLocked closes the window, making the first remaining window key if it was
+func (s *Server) removeWindowLocked(w *window) {
+	s.windows = slices.DeleteFunc(s.windows, func(other *window) bool { return other == w })
+	if s.activeWindow == w.id {
+		s.activeWindow = ""
+		if len(s.windows) > 0 {
+			s.activeWindow = s.windows[0].id
+		}
+	}
+}
+
+// SetBusy marks the session as running a job, so that closing it without force
+// is declined, as if the user had refused to confirm
+func (s *Server) SetBusy(sid string, busy bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[sid]
+	if sess == nil {
+		return false
+	}
+	sess.busy = busy
+	return true
+}
+
+// Exit ends the job of the session, which stays open until it is restarted or closed
+func (s *Server) Exit(sid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[sid]
+	if sess == nil {
+		return false
+	}
+	sess.exited, sess.busy = true, false
+	return true
+}
+
+// Focus makes the session active in its tab, selects the tab and makes its window key
+func (s *Server) Focus(sid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, t, n := s.locateSession(sid)
+	if n == nil {
+		return false
+	}
+	t.active = sid
+	w.selected = t.id
+	s.activeWindow = w.id
+	s.emitFocusLocked()
+	s.flushLocked()
+	return true
+}
+
+// SetVariable sets a session variable to a JSON encoded value, e.g. "jobPid" or "tmuxWindowPane"
+func (s *Server) SetVariable(sid, name, jsonValue string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[sid]
+	if sess == nil {
+		return false
+	}
+	sess.vars[name] = jsonValue
+	s.emitVariableLocked(api.VariableScope_SESSION, sid, name, jsonValue)
+	s.flushLocked()
+	return true
+}
+
+// SetTmux marks a tab as a tmux integration window of the given connection,
+// owned by the session running `tmux -CC`
+func (s *Server) SetTmux(tid, connectionID, windowID, owningSessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, t := s.findTab(tid)
+	if t == nil {
+		return false
+	}
+	t.tmuxConnectionID = connectionID
+	t.tmuxWindowID = windowID
+	s.tmuxOwners[connectionID] = owningSessionID
+	s.emitLayoutLocked()
+	s.flushLocked()
+	return true
+}
+
+// Input returns the text sent to the session with SendTextRequest
+func (s *Server) Input(sid string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess := s.sessions[sid]; sess != nil {
+		return string(sess.input)
+	}
+	return ""
+}
+
+// Output returns the data written to the session with InjectRequest
+func (s *Server) Output(sid string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess := s.sessions[sid]; sess != nil {
+		return string(sess.output)
+	}
+	return ""
+}
+
+// Title returns the title of a window or tab, or the name of a session
+func (s *Server) Title(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w := s.findWindow(id); w != nil {
+		return w.title
+	}
+	if _, t := s.findTab(id); t != nil {
+		return t.title
+	}
+	if sess := s.sessions[id]; sess != nil {
+		return sess.name
+	}
+	return ""
+}
+
+// MenuItems returns the identifiers of the menu items selected so far
+func (s *Server) MenuItems() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.menuItems)
+}
+
+// ListSessions returns the current model as iTerm2 would describe it
+func (s *Server) ListSessions() *api.ListSessionsResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listSessionsLocked()
+}
@@ -0,0 +1,270 @@
+package iterm2
+
+import (
+	"context"
+	"slices"
+
+	"github.com/trzsz/iterm2/api"
+)
+
+// Point is a position in points, from the bottom left corner of the screen for windows
+type Point struct {
+	X int
+	Y int
+}
+
+// Size is a size in points, or in cells for the grid size of a session
+type Size struct {
+	Width  int
+	Height int
+}
+
+// Rect is a rectangle in points
+type Rect struct {
+	Origin Point
+	Size   Size
+}
+
+// Layout is a snapshot of the windows, tabs and split panes of iTerm2, see App.Layout.
+// It is never updated, every call returns a new Layout that the caller may modify.
+type Layout struct {
+	Windows []WindowInfo
+	// BuriedSessions are the sessions that are not shown in any tab
+	BuriedSessions []SessionInfo
+}
+
+// WindowInfo describes a window of a Layout
+type WindowInfo struct {
+	ID     string
+	Number int
+	Frame  Rect
+	Tabs   []TabInfo
+}
+
+// TabInfo describes a tab of a Layout
+type TabInfo struct {
+	ID       string
+	WindowID string
+	// TmuxWindowID and TmuxConnectionID are set for the tabs of a tmux integration session
+	TmuxWindowID     string
+	TmuxConnectionID string
+	Root             PaneNode
+	// MinimizedSessions are the sessions of the tab that are minimized, they are not in Root
+	MinimizedSessions []SessionInfo
+}
+
+// PaneNode is a node of the split tree of a tab: either a session or
+// panes separated by vertical or horizontal dividers
+type PaneNode struct {
+	// Session is set for a leaf of the tree
+	Session *SessionInfo
+	// Vertical reports whether the dividers between the children are vertical
+	Vertical bool
+	Children []PaneNode
+}
+
+// SessionInfo describes a session of a Layout
+type SessionInfo struct {
+	ID       string
+	WindowID string
+	TabID    string
+	Title    string
+	// Frame and GridSize are not set for buried sessions
+	Frame     Rect
+	GridSize  Size
+	Minimized bool
+	Buried    bool
+}
+
+// Layout returns a snapshot of all windows, tabs and split panes
+func (a *App) Layout() (*Layout, error) {
+	return a.LayoutContext(context.Background())
+}
+
+// LayoutContext is like Layout but takes a context
+func (a *App) LayoutContext(ctx context.Context) (*Layout, error) {
+	if c := a.cache.Load(); c != nil {
+		return c.LayoutContext(ctx)
+	}
+	lsResp, err := Do[*api.ListSessionsResponse](ctx, a, &api.ListSessionsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return newLayout(lsResp), nil
+}
+
+func newLayout(lsResp *api.ListSessionsResponse) *Layout {
+	layout := &Layout{}
+	for _, w := range lsResp.GetWindows() {
+		window := WindowInfo{
+			ID:     w.GetWindowId(),
+			Number: int(w.GetNumber()),
+			Frame:  newRect(w.GetFrame()),
+		}
+		for _, t := range w.GetTabs() {
+			tab := TabInfo{
+				ID:               t.GetTabId(),
+				WindowID:         window.ID,
+				TmuxWindowID:     t.GetTmuxWindowId(),
+				TmuxConnectionID: t.GetTmuxConnectionId(),
+				Root:             newPaneNode(t.GetRoot(), window.ID, t.GetTabId()),
+			}
+			for _, s := range t.GetMinimizedSessions() {
+				info := newSessionInfo(s, window.ID, tab.ID)
+				info.Minimized = true
+				tab.MinimizedSessions = append(tab.MinimizedSessions, info)
+			}
+			window.Tabs = append(window.Tabs, tab)
+		}
+		layout.Windows = append(layout.Windows, window)
+	}
+	for _, s := range lsResp.GetBuriedSessions() {
+		info := newSessionInfo(s, "", "")
+		info.Buried = true
+		layout.BuriedSessions = append(layout.BuriedSessions, info)
+	}
+	return layout
+}
+
+// clone returns a deep copy of the layout
+func (l *Layout) clone() *Layout {
+	layout := &Layout{BuriedSessions: slices.Clone(l.BuriedSessions)}
+	for _, w := range l.Windows {
+		window := w
+		window.Tabs = nil
+		for _, t := range w.Tabs {
+			tab := t
+			tab.Root = t.Root.clone()
+			tab.MinimizedSessions = slices.Clone(t.MinimizedSessions)
+			window.Tabs = append(window.Tabs, tab)
+		}
+		layout.Windows = append(layout.Windows, window)
+	}
+	return layout
+}
+
+// clone returns a deep copy of the tree below the node
+func (n PaneNode) clone() PaneNode {
+	pane := PaneNode{Vertical: n.Vertical}
+	if n.Session != nil {
+		session := *n.Session
+		pane.Session = &session
+	}
+	for _, child := range n.Children {
+		pane.Children = append(pane.Children, child.clone())
+	}
+	return pane
+}
+
+func newPaneNode(node *api.SplitTreeNode, wid, tid string) PaneNode {
+	pane := PaneNode{Vertical: node.GetVertical()}
+	for _, link := range node.GetLinks() {
+		switch child := link.GetChild().(type) {
+		case *api.SplitTreeNode_SplitTreeLink_Session:
+			info := newSessionInfo(child.Session, wid, tid)
+			pane.Children = append(pane.Children, PaneNode{Session: &info})
+		case *api.SplitTreeNode_SplitTreeLink_Node:
+			pane.Children = append(pane.Children, newPaneNode(child.Node, wid, tid))
+		}
+	}
+	return pane
+}
+
+func newSessionInfo(s *api.SessionSummary, wid, tid string) SessionInfo {
+	return SessionInfo{
+		ID:       s.GetUniqueIdentifier(),
+		WindowID: wid,
+		TabID:    tid,
+		Title:    s.GetTitle(),
+		Frame:    newRect(s.GetFrame()),
+		GridSize: newSize(s.GetGridSize()),
+	}
+}
+
+func newRect(f *api.Frame) Rect {
+	return Rect{
+		Origin: Point{X: int(f.GetOrigin().GetX()), Y: int(f.GetOrigin().GetY())},
+		Size:   newSize(f.GetSize()),
+	}
+}
+
+func newSize(s *api.Size) Size {
+	return Size{Width: int(s.GetWidth()), Height: int(s.GetHeight())}
+}
+
+// Sessions returns the sessions of the split trees of every tab, in order.
+// Minimized and buried sessions are not included.
+func (l *Layout) Sessions() []SessionInfo {
+	var list []SessionInfo
+	for _, w := range l.Windows {
+		list = append(list, w.Sessions()...)
+	}
+	return list
+}
+
+// Window returns the window with the given id
+func (l *Layout) Window(wid string) (WindowInfo, bool) {
+	for _, w := range l.Windows {
+		if w.ID == wid {
+			return w, true
+		}
+	}
+	return WindowInfo{}, false
+}
+
+// Tab returns the tab with the given id
+func (l *Layout) Tab(tid string) (TabInfo, bool) {
+	for _, w := range l.Windows {
+		for _, t := range w.Tabs {
+			if t.ID == tid {
+				return t, true
+			}
+		}
+	}
+	return TabInfo{}, false
+}
+
+// Session returns the session with the given id, including minimized and buried sessions
+func (l *Layout) Session(sid string) (SessionInfo, bool) {
+	for _, w := range l.Windows {
+		for _, t := range w.Tabs {
+			for _, s := range append(t.Root.Sessions(), t.MinimizedSessions...) {
+				if s.ID == sid {
+					return s, true
+				}
+			}
+		}
+	}
+	for _, s := range l.BuriedSessions {
+		if s.ID == sid {
+			return s, true
+		}
+	}
+	return SessionInfo{}, false
+}
+
+// Sessions returns the sessions of the split trees of the tabs of the window, in order
+func (w WindowInfo) Sessions() []SessionInfo {
+	var list []SessionInfo
+	for _, t := range w.Tabs {
+		list = append(list, t.Root.Sessions()...)
+	}
+	return list
+}
+
+// Sessions returns the sessions of the split tree of the tab, in order
+func (t TabInfo) Sessions() []SessionInfo {
+	return t.Root.Sessions()
+}
+
+// Sessions returns the sessions of the tree below the node, in order
+func (n PaneNode) Sessions() []SessionInfo {
+	if n.Session != nil {
+		return []SessionInfo{*n.Session}
+	}
+	var list []SessionInfo
+	for _, child := range n.Children {
+		list = append(list, child.Sessions()...)
+	}
+	return list
+}
@@ -0,0 +1,115 @@
+package iterm2
+
+import (
+	"context"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+)
+
+// Subscribe asks iTerm2 for the notifications described by req and calls handler for each of them.
+// Handlers run one at a time on a dedicated goroutine and may call back into the App.
+// Prompt monitor modes fail with ErrUnsupported if the connected iTerm2 lacks FeaturePromptMonitorModes.
+func (a *App) Subscribe(req *api.NotificationRequest, handler func(*api.Notification)) (*client.Subscription, error) {
+	return a.SubscribeContext(context.Background(), req, handler)
+}
+
+// SubscribeContext is like Subscribe but takes a context
+func (a *App) SubscribeContext(ctx context.Context, req *api.NotificationRequest, handler func(*api.Notification)) (*client.Subscription, error) {
+	if err := a.requireRequest(req); err != nil {
+		return nil, err
+	}
+	return a.c.SubscribeContext(ctx, req, handler)
+}
+
+// SubscribeChan is like Subscribe but delivers the notifications to a channel with the given buffer size.
+// The channel is closed after the subscription is cancelled or the App is closed.
+func (a *App) SubscribeChan(req *api.NotificationRequest, size int) (<-chan *api.Notification, *client.Subscription, error) {
+	return a.SubscribeChanContext(context.Background(), req, size)
+}
+
+// SubscribeChanContext is like SubscribeChan but takes a context
+func (a *App) SubscribeChanContext(ctx context.Context, req *api.NotificationRequest, size int) (<-chan *api.Notification, *client.Subscription, error) {
+	if err := a.requireRequest(req); err != nil {
+		return nil, nil, err
+	}
+	return a.c.SubscribeChanContext(ctx, req, size)
+}
+
+// OnNewSession calls handler with the id of every newly created session
+func (a *App) OnNewSession(handler func(sid string)) (*client.Subscription, error) {
+	return a.Subscribe(newNotificationRequest(api.NotificationType_NOTIFY_ON_NEW_SESSION, ""), func(n *api.Notification) {
+		handler(n.GetNewSessionNotification().GetSessionId())
+	})
+}
+
+// OnTerminateSession calls handler with the id of every terminated session
+func (a *App) OnTerminateSession(handler func(sid string)) (*client.Subscription, error) {
+	return a.Subscribe(newNotificationRequest(api.NotificationType_NOTIFY_ON_TERMINATE_SESSION, ""), func(n *api.Notification) {
+		handler(n.GetTerminateSessionNotification().GetSessionId())
+	})
+}
+
+// OnLayoutChange calls handler whenever windows, tabs or split panes change
+func (a *App) OnLayoutChange(handler func(*api.LayoutChangedNotification)) (*client.Subscription, error) {
+	return a.Subscribe(newNotificationRequest(api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE, ""), func(n *api.Notification) {
+		handler(n.GetLayoutChangedNotification())
+	})
+}
+
+// OnFocusChange calls handler whenever the active window, tab or session changes
+func (a *App) OnFocusChange(handler func(*api.FocusChangedNotification)) (*client.Subscription, error) {
+	return a.Subscribe(newNotificationRequest(api.NotificationType_NOTIFY_ON_FOCUS_CHANGE, ""), func(n *api.Notification) {
+		handler(n.GetFocusChangedNotification())
+	})
+}
+
+// Subscribe asks iTerm2 for notifications of the given type about this session
+func (s *Session) Subscribe(typ api.NotificationType, handler func(*api.Notification)) (*client.Subscription, error) {
+	return s.SubscribeContext(context.Background(), typ, handler)
+}
+
+// SubscribeContext is like Subscribe but takes a context
+func (s *Session) SubscribeContext(ctx context.Context, typ api.NotificationType, handler func(*api.Notification)) (*client.Subscription, error) {
+	return s.app.SubscribeContext(ctx, newNotificationRequest(typ, s.sid), handler)
+}
+
+// OnScreenUpdate calls handler whenever the contents of this session change
+func (s *Session) OnScreenUpdate(handler func()) (*client.Subscription, error) {
+	return s.Subscribe(api.NotificationType_NOTIFY_ON_SCREEN_UPDATE, func(*api.Notification) {
+		handler()
+	})
+}
+
+// OnPrompt calls handler for every prompt, command start and command end in this session.
+// It requires shell integration to be installed.
+func (s *Session) OnPrompt(handler func(*api.PromptNotification)) (*client.Subscription, error) {
+	return s.Subscribe(api.NotificationType_NOTIFY_ON_PROMPT, func(n *api.Notification) {
+		handler(n.GetPromptNotification())
+	})
+}
+
+// OnVariableChange calls handler with the JSON encoded value whenever the named session variable changes
+func (s *Session) OnVariableChange(name string, handler func(jsonValue string)) (*client.Subscription, error) {
+	req := newNotificationRequest(api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE, "")
+	req.Arguments = &api.NotificationRequest_VariableMonitorRequest{
+		VariableMonitorRequest: &api.VariableMonitorRequest{
+			Name:       &name,
+			Scope:      api.VariableScope_SESSION.Enum(),
+			Identifier: &s.sid,
+		},
+	}
+	return s.app.Subscribe(req, func(n *api.Notification) {
+		handler(n.GetVariableChangedNotification().GetJsonNewValue())
+	})
+}
+
+func newNotificationRequest(typ api.NotificationType, session string) *api.NotificationRequest {
+	req := &api.NotificationRequest{
+		NotificationType: typ.Enum(),
+	}
+	if session != "" {
+		req.Session = &session
+	}
+	return req
+}
@@ -0,0 +1,119 @@
+package iterm2_test
+
+import (
+	"testing"
+
+	"github.com/trzsz/iterm2/api"
+)
+
+func TestOnNewSession(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	ch := make(chan string, 4)
+	sub, err := app.OnNewSession(func(sid string) { ch <- sid })
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	_, _, sid := srv.CreateWindow()
+	if got := receive(t, ch); got != sid {
+		t.Fatalf("new session = %v, want %v", got, sid)
+	}
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("unsubscribe failed: %v", err)
+	}
+	srv.CreateWindow()
+	nothing(t, ch)
+}
+
+func TestSessionSubscriptionFiltersSessions(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	_, s1, _ := app.CreateWindow()
+	_, s2, _ := app.CreateWindow()
+
+	ch := make(chan string, 4)
+	_, err := s1.Subscribe(api.NotificationType_NOTIFY_ON_SCREEN_UPDATE, func(n *api.Notification) {
+		ch <- n.GetScreenUpdateNotification().GetSession()
+	})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	if err := s2.Inject([]byte("other")); err != nil {
+		t.Fatalf("inject failed: %v", err)
+	}
+	if err := s1.Inject([]byte("mine")); err != nil {
+		t.Fatalf("inject failed: %v", err)
+	}
+	if got := receive(t, ch); got != s1.GetSessionID() {
+		t.Fatalf("screen update of %v, want %v", got, s1.GetSessionID())
+	}
+	nothing(t, ch)
+}
+
+func TestSharedSubscription(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	ch1, ch2 := make(chan string, 4), make(chan string, 4)
+	sub1, err := app.OnTerminateSession(func(sid string) { ch1 <- sid })
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	// iTerm2 refuses a second identical subscription, so both handlers share one
+	if _, err := app.OnTerminateSession(func(sid string) { ch2 <- sid }); err != nil {
+		t.Fatalf("subscribe again failed: %v", err)
+	}
+	_, _, sid := srv.CreateWindow()
+	srv.TerminateSession(sid)
+	if receive(t, ch1) != sid || receive(t, ch2) != sid {
+		t.Fatal("both handlers should receive the notification")
+	}
+
+	if err := sub1.Unsubscribe(); err != nil {
+		t.Fatalf("unsubscribe failed: %v", err)
+	}
+	_, _, sid = srv.CreateWindow()
+	srv.TerminateSession(sid)
+	if got := receive(t, ch2); got != sid {
+		t.Fatalf("terminated session = %v, want %v", got, sid)
+	}
+	nothing(t, ch1)
+}
+
+func TestSubscribeChan(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	req := &api.NotificationRequest{NotificationType: api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE.Enum()}
+	ch, sub, err := app.SubscribeChan(req, 1)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	srv.CreateWindow()
+	if n := receive(t, ch); n.GetLayoutChangedNotification() == nil {
+		t.Fatalf("notification = %v, want a layout change", n)
+	}
+
+	// unsubscribing closes the channel even while delivery is blocked on a full channel
+	srv.CreateWindow()
+	srv.CreateWindow()
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("unsubscribe failed: %v", err)
+	}
+	waitClosed(t, ch)
+}
+
+func TestSubscribeChanClosedByClose(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	req := &api.NotificationRequest{NotificationType: api.NotificationType_NOTIFY_ON_NEW_SESSION.Enum()}
+	ch, _, err := app.SubscribeChan(req, 1)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	_ = app.Close()
+	waitClosed(t, ch)
+}
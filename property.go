@@ -0,0 +1,103 @@
+package iterm2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// RetryOptions makes a property change be sent again while iTerm2 answers FAILED,
+// which happens e.g. when toggling full screen while another window is also toggling.
+// DEFERRED and IMPOSSIBLE are never retried. A nil *RetryOptions sends a single request.
+type RetryOptions struct {
+	// Attempts is the maximum number of requests sent, at least 1
+	Attempts int
+
+	// Delay is the time waited between two attempts
+	Delay time.Duration
+}
+
+// jsonRect is the JSON value of the frame property
+type jsonRect struct {
+	Origin struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	} `json:"origin"`
+	Size jsonSize `json:"size"`
+}
+
+// jsonSize is the JSON value of a size, such as the grid_size property
+type jsonSize struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func newJSONRect(r Rect) jsonRect {
+	var j jsonRect
+	j.Origin.X, j.Origin.Y = float64(r.Origin.X), float64(r.Origin.Y)
+	j.Size = jsonSize{Width: float64(r.Size.Width), Height: float64(r.Size.Height)}
+	return j
+}
+
+func (j jsonRect) rect() Rect {
+	return Rect{
+		Origin: Point{X: int(j.Origin.X), Y: int(j.Origin.Y)},
+		Size:   Size{Width: int(j.Size.Width), Height: int(j.Size.Height)},
+	}
+}
+
+// getProperty sends req and decodes the JSON value of the property into v
+func getProperty(ctx context.Context, a *App, req *api.GetPropertyRequest, v any) error {
+	gpResp, err := Do[*api.GetPropertyResponse](ctx, a, req)
+	if err != nil {
+		return invalidTarget(err, req.GetWindowId() != "")
+	}
+	if err := json.Unmarshal([]byte(gpResp.GetJsonValue()), v); err != nil {
+		return fmt.Errorf("unmarshal %s property failed: %w", req.GetName(), err)
+	}
+	return nil
+}
+
+// setProperty sets the property of req to the JSON encoding of v, retrying as told by retry if not nil
+func setProperty(ctx context.Context, a *App, req *api.SetPropertyRequest, v any, retry *RetryOptions) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal %s property failed: %w", req.GetName(), err)
+	}
+	req.JsonValue = proto.String(string(b))
+	attempts, delay := 1, time.Duration(0)
+	if retry != nil {
+		attempts, delay = max(retry.Attempts, 1), retry.Delay
+	}
+	for attempt := 1; ; attempt++ {
+		_, err = Do[*api.SetPropertyResponse](ctx, a, req)
+		if err == nil || !errors.Is(err, ErrFailed) || attempt >= attempts {
+			return invalidTarget(err, req.GetWindowId() != "")
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		}
+	}
+}
+
+// invalidTarget makes an INVALID_TARGET status, which is how iTerm2 answers a property request
+// for a missing window or session, also match ErrWindowNotFound or ErrSessionNotFound
+func invalidTarget(err error, window bool) error {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Name() != "INVALID_TARGET" {
+		return err
+	}
+	if window {
+		return fmt.Errorf("%w: %w", ErrWindowNotFound, err)
+	}
+	return fmt.Errorf("%w: %w", ErrSessionNotFound, err)
+}
@@ -0,0 +1,149 @@
+package iterm2_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/iterm2test"
+)
+
+func TestPropertiesOfClosedWindow(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	w, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	srv.TerminateSession(s.GetSessionID())
+
+	if _, err := w.Frame(); !errors.Is(err, iterm2.ErrWindowNotFound) || !errors.Is(err, iterm2.ErrNotFound) {
+		t.Fatalf("frame error = %v, want %v", err, iterm2.ErrWindowNotFound)
+	}
+	if err := w.SetFullscreen(true, nil); !errors.Is(err, iterm2.ErrWindowNotFound) || errors.Is(err, iterm2.ErrSessionNotFound) {
+		t.Fatalf("set fullscreen error = %v, want %v", err, iterm2.ErrWindowNotFound)
+	}
+	if _, err := s.GridSize(); !errors.Is(err, iterm2.ErrSessionNotFound) || errors.Is(err, iterm2.ErrWindowNotFound) {
+		t.Fatalf("grid size error = %v, want %v", err, iterm2.ErrSessionNotFound)
+	}
+	var statusErr *iterm2.StatusError
+	if _, err := s.GridSize(); !errors.As(err, &statusErr) || statusErr.Name() != "INVALID_TARGET" {
+		t.Fatalf("grid size error = %v, want an INVALID_TARGET status", err)
+	}
+}
+
+func TestWindowProperties(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	w, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+
+	frame := iterm2.Rect{Origin: iterm2.Point{X: 10, Y: 20}, Size: iterm2.Size{Width: 800, Height: 600}}
+	if err := w.SetFrame(frame); err != nil {
+		t.Fatalf("set frame failed: %v", err)
+	}
+	if got, err := w.Frame(); err != nil || got != frame {
+		t.Fatalf("frame = %+v, %v, want %+v", got, err, frame)
+	}
+	if err := w.SetFullscreen(true, nil); err != nil {
+		t.Fatalf("set fullscreen failed: %v", err)
+	}
+	if fullscreen, err := w.IsFullscreen(); err != nil || !fullscreen {
+		t.Fatalf("fullscreen = %v, %v, want true", fullscreen, err)
+	}
+	if err := w.SetFrame(frame); !errors.Is(err, iterm2.ErrImpossible) {
+		t.Fatalf("set frame of a full screen window error = %v, want %v", err, iterm2.ErrImpossible)
+	}
+	if err := s.SetGridSize(100, 40); !errors.Is(err, iterm2.ErrImpossible) {
+		t.Fatalf("set grid size in a full screen window error = %v, want %v", err, iterm2.ErrImpossible)
+	}
+}
+
+func TestSessionProperties(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	_, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+
+	if err := s.SetGridSize(100, 40); err != nil {
+		t.Fatalf("set grid size failed: %v", err)
+	}
+	if size, err := s.GridSize(); err != nil || size != (iterm2.Size{Width: 100, Height: 40}) {
+		t.Fatalf("grid size = %+v, %v, want 100x40", size, err)
+	}
+	if lines, err := s.LineCounts(); err != nil || lines.Grid != 40 {
+		t.Fatalf("line counts = %+v, %v, want 40 grid lines", lines, err)
+	}
+	if err := s.SetGridSize(0, 40); !errors.Is(err, iterm2.ErrMalformed) {
+		t.Fatalf("set empty grid size error = %v, want %v", err, iterm2.ErrMalformed)
+	}
+
+	if err := s.SetBuried(true); err != nil {
+		t.Fatalf("bury failed: %v", err)
+	}
+	if buried, err := s.IsBuried(); err != nil || !buried {
+		t.Fatalf("buried = %v, %v, want true", buried, err)
+	}
+	if err := s.SetBuried(false); err != nil {
+		t.Fatalf("disinter failed: %v", err)
+	}
+	if buried, err := s.IsBuried(); err != nil || buried {
+		t.Fatalf("buried = %v, %v, want false", buried, err)
+	}
+}
+
+// failSetProperty makes srv answer FAILED to the next n set_property_request,
+// and returns the number of set_property_request received
+func failSetProperty(srv *iterm2test.Server, n int32) *atomic.Int32 {
+	var count atomic.Int32
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetSetPropertyRequest() == nil || count.Add(1) > n {
+			return nil
+		}
+		return &api.ServerOriginatedMessage{Submessage: &api.ServerOriginatedMessage_SetPropertyResponse{
+			SetPropertyResponse: &api.SetPropertyResponse{Status: api.SetPropertyResponse_FAILED.Enum()},
+		}}
+	})
+	return &count
+}
+
+func TestSetPropertyRetry(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	w, _, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+
+	count := failSetProperty(srv, 1)
+	if err := w.SetFullscreen(true, nil); !errors.Is(err, iterm2.ErrFailed) || count.Load() != 1 {
+		t.Fatalf("set fullscreen without retry = %v after %d requests, want %v after one", err, count.Load(), iterm2.ErrFailed)
+	}
+
+	count = failSetProperty(srv, 2)
+	if err := w.SetFullscreen(true, &iterm2.RetryOptions{Attempts: 2, Delay: time.Millisecond}); !errors.Is(err, iterm2.ErrFailed) || count.Load() != 2 {
+		t.Fatalf("set fullscreen with 2 attempts = %v after %d requests, want %v after two", err, count.Load(), iterm2.ErrFailed)
+	}
+
+	count = failSetProperty(srv, 2)
+	if err := w.SetFullscreen(true, &iterm2.RetryOptions{Attempts: 3, Delay: time.Millisecond}); err != nil || count.Load() != 3 {
+		t.Fatalf("set fullscreen with 3 attempts = %v after %d requests, want success after three", err, count.Load())
+	}
+
+	failSetProperty(srv, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = w.SetFullscreenContext(ctx, false, &iterm2.RetryOptions{Attempts: 2, Delay: time.Hour})
+	if !errors.Is(err, iterm2.ErrFailed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("set fullscreen cancelled while waiting error = %v, want %v and %v", err, iterm2.ErrFailed, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,137 @@
+package iterm2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/trzsz/iterm2/api"
+	"google.golang.org/protobuf/proto"
+)
+
+// Version is an API protocol version of iTerm2
+type Version struct {
+	Major int
+	Minor int
+}
+
+// ParseVersion parses a protocol version such as "1.10"
+func ParseVersion(s string) (Version, error) {
+	major, minor, ok := strings.Cut(s, ".")
+	if !ok {
+		minor = "0"
+	}
+	var v Version
+	var err error
+	if v.Major, err = strconv.Atoi(major); err != nil {
+		return Version{}, fmt.Errorf("invalid protocol version: %q", s)
+	}
+	if v.Minor, err = strconv.Atoi(minor); err != nil {
+		return Version{}, fmt.Errorf("invalid protocol version: %q", s)
+	}
+	return v, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// AtLeast reports whether v is the same as or newer than since
+func (v Version) AtLeast(since Version) bool {
+	return v.Major > since.Major || v.Major == since.Major && v.Minor >= since.Minor
+}
+
+// Feature is a part of the API that only some versions of iTerm2 provide.
+// Only the features that the iTerm2 Python API itself checks against the protocol
+// version are listed; other requests, such as CloseRequest, are always attempted.
+// Do and Subscribe fail with ErrUnsupported before sending a request needing a missing
+// feature, except for FeatureSelectPaneIgnoringSpacing, an argument of an invoked function.
+type Feature string
+
+const (
+	// FeatureMultipleSetProfileProperties is setting several profile properties in one request
+	FeatureMultipleSetProfileProperties Feature = "multiple_set_profile_properties"
+
+	// FeatureSelectPaneIgnoringSpacing is selecting the pane in a direction ignoring the spacing between panes
+	FeatureSelectPaneIgnoringSpacing Feature = "select_pane_ignoring_spacing"
+
+	// FeaturePromptMonitorModes is choosing which prompt events a prompt subscription reports
+	FeaturePromptMonitorModes Feature = "prompt_monitor_modes"
+
+	// FeatureListPrompts is listing the prompts of a session with ListPromptsRequest
+	FeatureListPrompts Feature = "list_prompts"
+)
+
+// features maps every Feature to the first protocol version providing it,
+// as checked by the capabilities module of the iTerm2 Python API
+var features = map[Feature]Version{
+	FeatureMultipleSetProfileProperties: {0, 69},
+	FeatureSelectPaneIgnoringSpacing:    {1, 1},
+	FeaturePromptMonitorModes:           {1, 2},
+	FeatureListPrompts:                  {1, 3},
+}
+
+// ServerInfo describes the iTerm2 the App is connected to. It has no application version
+// because iTerm2 only announces its API protocol version when a connection is opened.
+type ServerInfo struct {
+	// ProtocolVersion is the API protocol version announced by iTerm2 when connecting
+	ProtocolVersion Version
+
+	// Known is false if iTerm2 did not announce its protocol version,
+	// in which case every feature is assumed to be available
+	Known bool
+
+	// Features tells which features of this package are available
+	Features map[Feature]bool
+}
+
+// Supports reports whether the feature is available
+func (info ServerInfo) Supports(f Feature) bool {
+	if !info.Known {
+		return true
+	}
+	return info.Features[f]
+}
+
+// ServerInfo returns the protocol version of the connected iTerm2 and the features it provides.
+// A reconnecting App may end up connected to another version of iTerm2.
+func (a *App) ServerInfo() ServerInfo {
+	info := ServerInfo{Features: make(map[Feature]bool, len(features))}
+	if v, err := ParseVersion(a.c.ProtocolVersion()); err == nil {
+		info.ProtocolVersion, info.Known = v, true
+	}
+	for f, since := range features {
+		info.Features[f] = !info.Known || info.ProtocolVersion.AtLeast(since)
+	}
+	return info
+}
+
+// Require fails with ErrUnsupported if the feature is not available, e.g. before
+// invoking iterm2.select_pane_in_direction with ignore_spacing
+func (info ServerInfo) Require(f Feature) error {
+	if info.Supports(f) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s needs protocol version %v, iTerm2 has %v", ErrUnsupported, f, features[f], info.ProtocolVersion)
+}
+
+// requestFeature returns the feature needed to send req, if any
+func requestFeature(req proto.Message) (Feature, bool) {
+	switch req := req.(type) {
+	case *api.ListPromptsRequest:
+		return FeatureListPrompts, true
+	case *api.SetProfilePropertyRequest:
+		return FeatureMultipleSetProfileProperties, len(req.GetAssignments()) > 0
+	case *api.NotificationRequest:
+		return FeaturePromptMonitorModes, len(req.GetPromptMonitorRequest().GetModes()) > 0
+	}
+	return "", false
+}
+
+// requireRequest fails with ErrUnsupported if the connected iTerm2 lacks the feature needed to send req
+func (a *App) requireRequest(req proto.Message) error {
+	if f, ok := requestFeature(req); ok {
+		return a.ServerInfo().Require(f)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package iterm2_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+)
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want iterm2.Version
+		ok   bool
+	}{
+		{"1.10", iterm2.Version{Major: 1, Minor: 10}, true},
+		{"0.69", iterm2.Version{Major: 0, Minor: 69}, true},
+		{"2", iterm2.Version{Major: 2}, true},
+		{"", iterm2.Version{}, false},
+		{"1.x", iterm2.Version{}, false},
+	} {
+		got, err := iterm2.ParseVersion(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+	if !(iterm2.Version{Major: 1, Minor: 10}).AtLeast(iterm2.Version{Major: 1, Minor: 2}) {
+		t.Error("1.10 should be at least 1.2")
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetProtocolVersion("1.1")
+	info := newTestApp(t, srv).ServerInfo()
+
+	if !info.Known || info.ProtocolVersion != (iterm2.Version{Major: 1, Minor: 1}) {
+		t.Fatalf("server info = %+v, want protocol version 1.1", info)
+	}
+	if err := info.Require(iterm2.FeatureSelectPaneIgnoringSpacing); err != nil {
+		t.Fatalf("require %s failed: %v", iterm2.FeatureSelectPaneIgnoringSpacing, err)
+	}
+	if err := info.Require(iterm2.FeatureListPrompts); !errors.Is(err, iterm2.ErrUnsupported) {
+		t.Fatalf("require %s error = %v, want %v", iterm2.FeatureListPrompts, err, iterm2.ErrUnsupported)
+	}
+
+	srv.SetProtocolVersion("")
+	info = newTestApp(t, srv).ServerInfo()
+	if info.Known || !info.Supports(iterm2.FeatureListPrompts) {
+		t.Fatalf("server info = %+v, want every feature assumed available", info)
+	}
+}
+
+func TestUnsupportedRequests(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetProtocolVersion("1.1")
+	app := newTestApp(t, srv)
+	var sent atomic.Int32
+	srv.Handle(func(*api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		sent.Add(1)
+		return nil
+	})
+
+	if _, err := iterm2.Do[*api.ListPromptsResponse](context.Background(), app, &api.ListPromptsRequest{}); !errors.Is(err, iterm2.ErrUnsupported) {
+		t.Fatalf("list prompts error = %v, want %v", err, iterm2.ErrUnsupported)
+	}
+	req := &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_PROMPT.Enum(),
+		Arguments: &api.NotificationRequest_PromptMonitorRequest{PromptMonitorRequest: &api.PromptMonitorRequest{
+			Modes: []api.PromptMonitorMode{api.PromptMonitorMode_COMMAND_END},
+		}},
+	}
+	if _, _, err := app.SubscribeChan(req, 1); !errors.Is(err, iterm2.ErrUnsupported) {
+		t.Fatalf("subscribe with prompt monitor modes error = %v, want %v", err, iterm2.ErrUnsupported)
+	}
+	if n := sent.Load(); n != 0 {
+		t.Fatalf("%d requests sent, want unsupported requests to fail before sending", n)
+	}
+
+	if _, err := iterm2.Do[*api.ListSessionsResponse](context.Background(), app, &api.ListSessionsRequest{}); err != nil {
+		t.Fatalf("list sessions failed: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -58,111 +59,79 @@ func (s *Session) GetSessionID() string {
 
 // Inject injects data as though it were program output
 func (s *Session) Inject(data []byte) error {
-	resp, err := s.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_InjectRequest{
-			InjectRequest: &api.InjectRequest{
-				SessionId: []string{s.sid},
-				Data:      data,
-			},
-		},
+	return s.InjectContext(context.Background(), data)
+}
+
+// InjectContext is like Inject but takes a context
+func (s *Session) InjectContext(ctx context.Context, data []byte) error {
+	iResp, err := Do[*api.InjectResponse](ctx, s.app, &api.InjectRequest{
+		SessionId: []string{s.sid},
+		Data:      data,
 	})
 	if err != nil {
-		return fmt.Errorf("call inject_request failed: %w", err)
-	}
-
-	iResp := resp.GetInjectResponse()
-	if iResp == nil {
-		return fmt.Errorf("inject_response is nil")
+		return err
 	}
 
 	status := iResp.GetStatus()
 	if len(status) != 1 {
 		return fmt.Errorf("inject_response status count is not one: %v", status)
 	}
-	if status[0] != api.InjectResponse_OK {
-		return fmt.Errorf("inject_response status is not ok: %v", status[0])
-	}
 	return nil
 }
 
 // SendText sends text as though the user had typed it
 func (s *Session) SendText(text string) error {
-	resp, err := s.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_SendTextRequest{
-			SendTextRequest: &api.SendTextRequest{
-				Session: &s.sid,
-				Text:    &text,
-			},
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("call send_text_request failed: %w", err)
-	}
+	return s.SendTextContext(context.Background(), text)
+}
 
-	stResp := resp.GetSendTextResponse()
-	if stResp == nil {
-		return fmt.Errorf("send_text_response is nil")
-	}
-	if stResp.GetStatus() != api.SendTextResponse_OK {
-		return fmt.Errorf("send_text_response status is not ok: %v", stResp.GetStatus())
-	}
-	return nil
+// SendTextContext is like SendText but takes a context
+func (s *Session) SendTextContext(ctx context.Context, text string) error {
+	_, err := Do[*api.SendTextResponse](ctx, s.app, &api.SendTextRequest{
+		Session: &s.sid,
+		Text:    &text,
+	})
+	return err
 }
 
 // Activate makes the session the active session in its tab
 // selectTab: whether the tab this session is in should be selected
 // orderWindowFront: whether the window this session is in should be brought to the front and given keyboard focus
 func (s *Session) Activate(selectTab, orderWindowFront bool) error {
-	resp, err := s.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ActivateRequest{
-			ActivateRequest: &api.ActivateRequest{
-				Identifier: &api.ActivateRequest_SessionId{
-					SessionId: s.sid,
-				},
-				SelectTab:        &selectTab,
-				OrderWindowFront: &orderWindowFront,
-			},
+	return s.ActivateContext(context.Background(), selectTab, orderWindowFront)
+}
+
+// ActivateContext is like Activate but takes a context
+func (s *Session) ActivateContext(ctx context.Context, selectTab, orderWindowFront bool) error {
+	_, err := Do[*api.ActivateResponse](ctx, s.app, &api.ActivateRequest{
+		Identifier: &api.ActivateRequest_SessionId{
+			SessionId: s.sid,
 		},
+		SelectTab:        &selectTab,
+		OrderWindowFront: &orderWindowFront,
 	})
-	if err != nil {
-		return fmt.Errorf("call activate_request failed: %w", err)
-	}
-
-	aResp := resp.GetActivateResponse()
-	if aResp == nil {
-		return fmt.Errorf("activate_response is nil")
-	}
-	if aResp.GetStatus() != api.ActivateResponse_OK {
-		return fmt.Errorf("activate_response status is not ok: %v", aResp.GetStatus())
-	}
-	return nil
+	s.app.invalidateCache()
+	return err
 }
 
 // SplitPane splits the pane, creating a new session
 func (s *Session) SplitPane(opts SplitPaneOptions) (*Session, error) {
+	return s.SplitPaneContext(context.Background(), opts)
+}
+
+// SplitPaneContext is like SplitPane but takes a context
+func (s *Session) SplitPaneContext(ctx context.Context, opts SplitPaneOptions) (*Session, error) {
 	direction := api.SplitPaneRequest_HORIZONTAL.Enum()
 	if opts.Vertical {
 		direction = api.SplitPaneRequest_VERTICAL.Enum()
 	}
 
-	resp, err := s.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_SplitPaneRequest{
-			SplitPaneRequest: &api.SplitPaneRequest{
-				Session:        &s.sid,
-				SplitDirection: direction,
-			},
-		},
+	spResp, err := Do[*api.SplitPaneResponse](ctx, s.app, &api.SplitPaneRequest{
+		Session:        &s.sid,
+		SplitDirection: direction,
 	})
+	s.app.invalidateCache()
 	if err != nil {
-		return nil, fmt.Errorf("call split_pane_request failed: %w", err)
-	}
-
-	spResp := resp.GetSplitPaneResponse()
-	if spResp == nil {
-		return nil, fmt.Errorf("split_pane_response is nil")
-	}
-	if spResp.GetStatus() != api.SplitPaneResponse_OK {
-		return nil, fmt.Errorf("split_pane_response status is not ok: %v", spResp.GetStatus())
+		return nil, err
 	}
 
 	sid := spResp.GetSessionId()
@@ -174,26 +143,19 @@ func (s *Session) SplitPane(opts SplitPaneOptions) (*Session, error) {
 
 // GetVariable fetches a session variable
 func (s *Session) GetVariable(names ...string) ([]string, error) {
-	resp, err := s.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_VariableRequest{
-			VariableRequest: &api.VariableRequest{
-				Scope: &api.VariableRequest_SessionId{
-					SessionId: s.sid,
-				},
-				Get: names,
-			},
+	return s.GetVariableContext(context.Background(), names...)
+}
+
+// GetVariableContext is like GetVariable but takes a context
+func (s *Session) GetVariableContext(ctx context.Context, names ...string) ([]string, error) {
+	vResp, err := Do[*api.VariableResponse](ctx, s.app, &api.VariableRequest{
+		Scope: &api.VariableRequest_SessionId{
+			SessionId: s.sid,
 		},
+		Get: names,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("call variable_request failed: %w", err)
-	}
-
-	vResp := resp.GetVariableResponse()
-	if vResp == nil {
-		return nil, fmt.Errorf("variable_response is nil")
-	}
-	if vResp.GetStatus() != api.VariableResponse_OK {
-		return nil, fmt.Errorf("variable_response status is not ok: %v", vResp.GetStatus())
+		return nil, err
 	}
 
 	values := vResp.GetValues()
@@ -206,25 +168,18 @@ func (s *Session) GetVariable(names ...string) ([]string, error) {
 
 // IsTmuxIntegrationSession reports whether this session is attached to a tmux session
 func (s *Session) IsTmuxIntegrationSession() (bool, error) {
-	resp, err := s.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_TmuxRequest{
-			TmuxRequest: &api.TmuxRequest{
-				Payload: &api.TmuxRequest_ListConnections_{
-					ListConnections: &api.TmuxRequest_ListConnections{},
-				},
-			},
+	return s.IsTmuxIntegrationSessionContext(context.Background())
+}
+
+// IsTmuxIntegrationSessionContext is like IsTmuxIntegrationSession but takes a context
+func (s *Session) IsTmuxIntegrationSessionContext(ctx context.Context) (bool, error) {
+	tResp, err := Do[*api.TmuxResponse](ctx, s.app, &api.TmuxRequest{
+		Payload: &api.TmuxRequest_ListConnections_{
+			ListConnections: &api.TmuxRequest_ListConnections{},
 		},
 	})
 	if err != nil {
-		return false, fmt.Errorf("call tmux_list_connections failed: %w", err)
-	}
-
-	tResp := resp.GetTmuxResponse()
-	if tResp == nil {
-		return false, fmt.Errorf("tmux_response is nil")
-	}
-	if tResp.GetStatus() != api.TmuxResponse_OK {
-		return false, fmt.Errorf("tmux_response status is not ok: %v", tResp.GetStatus())
+		return false, err
 	}
 
 	payload := tResp.Payload
@@ -247,33 +202,133 @@ func (s *Session) IsTmuxIntegrationSession() (bool, error) {
 
 // RunTmuxCommand invokes a tmux command and return its result
 func (s *Session) RunTmuxCommand(command string, timeout float64) (string, error) {
+	return s.RunTmuxCommandContext(context.Background(), command, timeout)
+}
+
+// RunTmuxCommandContext is like RunTmuxCommand but takes a context
+func (s *Session) RunTmuxCommandContext(ctx context.Context, command string, timeout float64) (string, error) {
 	invocation := "iterm2.run_tmux_command(command: \"" + strings.ReplaceAll(strings.ReplaceAll(command, "\\", "\\\\"), "\"", "\\\"") + "\")"
-	resp, err := s.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{
-			InvokeFunctionRequest: &api.InvokeFunctionRequest{
-				Invocation: &invocation,
-				Context: &api.InvokeFunctionRequest_Method_{
-					Method: &api.InvokeFunctionRequest_Method{
-						Receiver: &s.sid,
-					},
-				},
-				Timeout: &timeout,
+	ifResp, err := Do[*api.InvokeFunctionResponse](ctx, s.app, &api.InvokeFunctionRequest{
+		Invocation: &invocation,
+		Context: &api.InvokeFunctionRequest_Method_{
+			Method: &api.InvokeFunctionRequest_Method{
+				Receiver: &s.sid,
 			},
 		},
+		Timeout: &timeout,
 	})
 	if err != nil {
-		return "", fmt.Errorf("call invoke_function_request failed: %w", err)
-	}
-
-	ifResp := resp.GetInvokeFunctionResponse()
-	if ifResp == nil {
-		return "", fmt.Errorf("invoke_function_response is nil")
+		return "", err
 	}
 	if success := ifResp.GetSuccess(); success != nil {
 		return success.GetJsonResult(), nil
 	}
-	if err := ifResp.GetError(); err != nil {
-		return "", fmt.Errorf("invoke_function_response error: %v", err.GetErrorReason())
-	}
 	return "", fmt.Errorf("unknown invoke_function_response: %+v", ifResp)
 }
+
+// LineCounts are the numbers of lines of a session, see Session.LineCounts
+type LineCounts struct {
+	// Overflow is the number of lines dropped from the scrollback history since the session started
+	Overflow int `json:"overflow"`
+
+	// Grid is the number of lines of the visible screen
+	Grid int `json:"grid"`
+
+	// History is the number of lines in the scrollback history, above the screen
+	History int `json:"history"`
+}
+
+// GridSize returns the size of the session in cells: Width is the number of columns and Height of rows
+func (s *Session) GridSize() (Size, error) {
+	return s.GridSizeContext(context.Background())
+}
+
+// GridSizeContext is like GridSize but takes a context
+func (s *Session) GridSizeContext(ctx context.Context) (Size, error) {
+	var size jsonSize
+	if err := getProperty(ctx, s.app, s.getPropertyRequest("grid_size"), &size); err != nil {
+		return Size{}, err
+	}
+	return Size{Width: int(size.Width), Height: int(size.Height)}, nil
+}
+
+// SetGridSize resizes the session to the given number of columns and rows, resizing its window as needed.
+// It fails with ErrDeferred during instant replay and with ErrImpossible in a full screen window.
+func (s *Session) SetGridSize(columns, rows int) error {
+	return s.SetGridSizeContext(context.Background(), columns, rows)
+}
+
+// SetGridSizeContext is like SetGridSize but takes a context
+func (s *Session) SetGridSizeContext(ctx context.Context, columns, rows int) error {
+	size := jsonSize{Width: float64(columns), Height: float64(rows)}
+	err := setProperty(ctx, s.app, s.setPropertyRequest("grid_size"), size, nil)
+	s.app.invalidateCache()
+	return err
+}
+
+// IsBuried reports whether the session is buried, i.e. hidden from every tab but still running
+func (s *Session) IsBuried() (bool, error) {
+	return s.IsBuriedContext(context.Background())
+}
+
+// IsBuriedContext is like IsBuried but takes a context
+func (s *Session) IsBuriedContext(ctx context.Context) (bool, error) {
+	var buried bool
+	err := getProperty(ctx, s.app, s.getPropertyRequest("buried"), &buried)
+	return buried, err
+}
+
+// SetBuried buries or disinters the session. The window and tab ids of this
+// Session are outdated afterwards, look the session up again to get them.
+func (s *Session) SetBuried(buried bool) error {
+	return s.SetBuriedContext(context.Background(), buried)
+}
+
+// SetBuriedContext is like SetBuried but takes a context
+func (s *Session) SetBuriedContext(ctx context.Context, buried bool) error {
+	err := setProperty(ctx, s.app, s.setPropertyRequest("buried"), buried, nil)
+	s.app.invalidateCache()
+	return err
+}
+
+// LineCounts returns how many lines the session has on screen and in its scrollback history
+func (s *Session) LineCounts() (LineCounts, error) {
+	return s.LineCountsContext(context.Background())
+}
+
+// LineCountsContext is like LineCounts but takes a context
+func (s *Session) LineCountsContext(ctx context.Context) (LineCounts, error) {
+	var counts LineCounts
+	err := getProperty(ctx, s.app, s.getPropertyRequest("number_of_lines"), &counts)
+	return counts, err
+}
+
+func (s *Session) getPropertyRequest(name string) *api.GetPropertyRequest {
+	return &api.GetPropertyRequest{
+		Identifier: &api.GetPropertyRequest_SessionId{SessionId: s.sid},
+		Name:       &name,
+	}
+}
+
+func (s *Session) setPropertyRequest(name string) *api.SetPropertyRequest {
+	return &api.SetPropertyRequest{
+		Identifier: &api.SetPropertyRequest_SessionId{SessionId: s.sid},
+		Name:       &name,
+	}
+}
+
+// Restart kills the job of the session, unless onlyIfExited is true, and starts it again
+// in place. Restarting fails with ErrSessionNotRestartable if the job is still running
+// and onlyIfExited is true, or if the session cannot be restarted at all.
+func (s *Session) Restart(onlyIfExited bool) error {
+	return s.RestartContext(context.Background(), onlyIfExited)
+}
+
+// RestartContext is like Restart but takes a context
+func (s *Session) RestartContext(ctx context.Context, onlyIfExited bool) error {
+	_, err := Do[*api.RestartSessionResponse](ctx, s.app, &api.RestartSessionRequest{
+		SessionId:    &s.sid,
+		OnlyIfExited: &onlyIfExited,
+	})
+	return err
+}
@@ -0,0 +1,33 @@
+package iterm2_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/trzsz/iterm2"
+)
+
+func TestRestart(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	_, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+
+	if err := s.Restart(true); !errors.Is(err, iterm2.ErrSessionNotRestartable) {
+		t.Fatalf("restart running session error = %v, want %v", err, iterm2.ErrSessionNotRestartable)
+	}
+	srv.Exit(s.GetSessionID())
+	if err := s.Restart(true); err != nil {
+		t.Fatalf("restart exited session failed: %v", err)
+	}
+	if err := s.Restart(false); err != nil {
+		t.Fatalf("restart running session failed: %v", err)
+	}
+
+	srv.TerminateSession(s.GetSessionID())
+	if err := s.Restart(false); !errors.Is(err, iterm2.ErrSessionNotFound) {
+		t.Fatalf("restart closed session error = %v, want %v", err, iterm2.ErrSessionNotFound)
+	}
+}
@@ -0,0 +1,227 @@
+package iterm2
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/client"
+)
+
+// StateCache keeps the layout and the focus of iTerm2 up to date from notifications,
+// so that looking them up does not need a request, see App.EnableStateCache.
+// Changes made through the App invalidate the cache, which is then reloaded on the
+// next lookup, as it is after a reconnect.
+type StateCache struct {
+	app  *App
+	subs []*client.Subscription
+
+	mu       sync.Mutex
+	stale    bool
+	gen      uint64 // bumped by every layout notification, so that a reload does not overwrite a newer layout
+	layout   *Layout
+	active   bool
+	windows  map[string]api.FocusChangedNotification_Window_WindowStatus
+	tabs     map[string]string // selected tab id by window id
+	sessions map[string]string // active session id by tab id
+}
+
+// EnableStateCache loads the layout and the focus of iTerm2 once, then keeps them
+// current with layout, focus, new session and terminate session notifications.
+// Afterwards, the lookups of the App such as ListWindows, ListTabs, ListSessions,
+// Layout and GetCurrentActiveSession are answered locally. Close the StateCache to stop it.
+func (a *App) EnableStateCache() (*StateCache, error) {
+	return a.EnableStateCacheContext(context.Background())
+}
+
+// EnableStateCacheContext is like EnableStateCache but takes a context
+func (a *App) EnableStateCacheContext(ctx context.Context) (*StateCache, error) {
+	c := &StateCache{app: a, stale: true}
+	handlers := map[api.NotificationType]func(*api.Notification){
+		api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE:     c.onLayoutChange,
+		api.NotificationType_NOTIFY_ON_FOCUS_CHANGE:      c.onFocusChange,
+		api.NotificationType_NOTIFY_ON_NEW_SESSION:       c.onSessionChange,
+		api.NotificationType_NOTIFY_ON_TERMINATE_SESSION: c.onSessionChange,
+	}
+	for typ, handler := range handlers {
+		sub, err := a.SubscribeContext(ctx, newNotificationRequest(typ, ""), handler)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		c.subs = append(c.subs, sub)
+	}
+	if err := c.reload(ctx); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	a.c.OnReconnect(c.Invalidate)
+	if !a.cache.CompareAndSwap(nil, c) {
+		_ = c.Close()
+		return nil, errors.New("state cache already enabled")
+	}
+	return c, nil
+}
+
+// Close stops updating the cache and makes the App send requests for every lookup again
+func (c *StateCache) Close() error {
+	c.app.cache.CompareAndSwap(c, nil)
+	var errs []error
+	for _, sub := range c.subs {
+		if err := sub.Unsubscribe(); err != nil && !errors.Is(err, ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Invalidate makes the next lookup reload the layout and the focus from iTerm2
+func (c *StateCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stale = true
+}
+
+// Layout returns a copy of the cached layout, reloading it first if the cache is invalid
+func (c *StateCache) Layout() (*Layout, error) {
+	return c.LayoutContext(context.Background())
+}
+
+// LayoutContext is like Layout but takes a context
+func (c *StateCache) LayoutContext(ctx context.Context) (*Layout, error) {
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.layout.clone(), nil
+}
+
+// refresh reloads the cache if it is invalid
+func (c *StateCache) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	stale := c.stale
+	c.mu.Unlock()
+	if !stale {
+		return nil
+	}
+	return c.reload(ctx)
+}
+
+func (c *StateCache) reload(ctx context.Context) error {
+	c.mu.Lock()
+	c.stale = false
+	gen := c.gen
+	c.mu.Unlock()
+
+	lsResp, err := Do[*api.ListSessionsResponse](ctx, c.app, &api.ListSessionsRequest{})
+	if err == nil {
+		var fResp *api.FocusResponse
+		fResp, err = Do[*api.FocusResponse](ctx, c.app, &api.FocusRequest{})
+		if err == nil {
+			c.mu.Lock()
+			if c.gen == gen {
+				c.layout = newLayout(lsResp)
+			}
+			c.windows = make(map[string]api.FocusChangedNotification_Window_WindowStatus)
+			c.tabs = make(map[string]string)
+			c.sessions = make(map[string]string)
+			for _, n := range fResp.GetNotifications() {
+				c.applyFocusLocked(n)
+			}
+			c.mu.Unlock()
+			return nil
+		}
+	}
+	c.Invalidate()
+	return err
+}
+
+// focus returns the focus the way App.getFocusInfo does
+func (c *StateCache) focus(ctx context.Context) (string, []string, []string, error) {
+	if err := c.refresh(ctx); err != nil {
+		return "", nil, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wid, found := "", false
+	for _, w := range c.layout.Windows {
+		status, ok := c.windows[w.ID]
+		if ok && (!found || status < c.windows[wid]) {
+			wid, found = w.ID, true
+		}
+	}
+	if !found {
+		return "", nil, nil, errors.New("no active window in focus_response")
+	}
+	var tabs, sessions []string
+	for _, tid := range c.tabs {
+		tabs = append(tabs, tid)
+	}
+	for _, sid := range c.sessions {
+		sessions = append(sessions, sid)
+	}
+	return wid, tabs, sessions, nil
+}
+
+func (c *StateCache) onLayoutChange(n *api.Notification) {
+	lsResp := n.GetLayoutChangedNotification().GetListSessionsResponse()
+	if lsResp == nil {
+		c.Invalidate()
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.layout = newLayout(lsResp)
+}
+
+func (c *StateCache) onFocusChange(n *api.Notification) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.applyFocusLocked(n.GetFocusChangedNotification())
+}
+
+// onSessionChange invalidates the cache, as the layout change notification may come after the next lookup
+func (c *StateCache) onSessionChange(*api.Notification) {
+	c.Invalidate()
+}
+
+func (c *StateCache) applyFocusLocked(n *api.FocusChangedNotification) {
+	if c.layout == nil {
+		return
+	}
+	switch ev := n.GetEvent().(type) {
+	case *api.FocusChangedNotification_ApplicationActive:
+		c.active = ev.ApplicationActive
+	case *api.FocusChangedNotification_Window_:
+		c.windows[ev.Window.GetWindowId()] = ev.Window.GetWindowStatus()
+	case *api.FocusChangedNotification_SelectedTab:
+		if tab, ok := c.layout.Tab(ev.SelectedTab); ok {
+			c.tabs[tab.WindowID] = tab.ID
+		} else {
+			c.stale = true
+		}
+	case *api.FocusChangedNotification_Session:
+		if session, ok := c.layout.Session(ev.Session); ok {
+			c.sessions[session.TabID] = session.ID
+		} else {
+			c.stale = true
+		}
+	}
+}
+
+// ApplicationActive reports whether iTerm2 is the active application
+func (c *StateCache) ApplicationActive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active
+}
+
+// invalidateCache invalidates the state cache of the App, if any, after a change made by the App
+func (a *App) invalidateCache() {
+	if c := a.cache.Load(); c != nil {
+		c.Invalidate()
+	}
+}
@@ -0,0 +1,164 @@
+package iterm2_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+	"github.com/trzsz/iterm2/iterm2test"
+)
+
+// countListSessions makes srv count the list_sessions_request it receives
+func countListSessions(srv *iterm2test.Server) *atomic.Int32 {
+	var n atomic.Int32
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetListSessionsRequest() != nil {
+			n.Add(1)
+		}
+		return nil
+	})
+	return &n
+}
+
+// eventually fails the test if cond does not become true in time
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the condition")
+		}
+	}
+}
+
+// enableStateCache enables the state cache of app, closed at the end of the test
+func enableStateCache(t *testing.T, app *iterm2.App) *iterm2.StateCache {
+	t.Helper()
+	cache, err := app.EnableStateCache()
+	if err != nil {
+		t.Fatalf("enable state cache failed: %v", err)
+	}
+	t.Cleanup(func() { _ = cache.Close() })
+	return cache
+}
+
+func TestStateCache(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	_, tid, sid := srv.CreateWindow()
+	cache := enableStateCache(t, app)
+	requests := countListSessions(srv)
+
+	for range 3 {
+		if windows, err := app.ListWindows(); err != nil || len(windows) != 1 {
+			t.Fatalf("list windows = %v, %v, want one window", windows, err)
+		}
+	}
+	srv.SetTmux(tid, "1", "@1", sid)
+	eventually(t, func() bool {
+		layout, err := cache.Layout()
+		if err != nil {
+			t.Fatalf("layout failed: %v", err)
+		}
+		tab, _ := layout.Tab(tid)
+		return tab.TmuxConnectionID == "1"
+	})
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("%d list_sessions_request sent, want the cache to answer", n)
+	}
+
+	// a change made by the App makes the next lookup reload the cache
+	if _, _, err := app.CreateWindow(); err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	if windows, err := app.ListWindows(); err != nil || len(windows) != 2 {
+		t.Fatalf("list windows = %v, %v, want two windows", windows, err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("%d list_sessions_request sent, want one reload", n)
+	}
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("close state cache failed: %v", err)
+	}
+	if _, err := app.ListWindows(); err != nil {
+		t.Fatalf("list windows failed: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("%d list_sessions_request sent, want a request once the cache is closed", n)
+	}
+}
+
+func TestStateCacheFocus(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	_, _, first := srv.CreateWindow()
+	_, _, second := srv.CreateWindow()
+	enableStateCache(t, app)
+
+	for _, sid := range []string{first, second, first} {
+		srv.Focus(sid)
+		eventually(t, func() bool {
+			session, err := app.GetCurrentActiveSession()
+			if err != nil {
+				t.Fatalf("get active session failed: %v", err)
+			}
+			return session.GetSessionID() == sid
+		})
+	}
+}
+
+func TestStateCacheLayoutCopy(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	wid, tid, sid := srv.CreateWindow()
+	cache := enableStateCache(t, app)
+
+	layout, err := cache.Layout()
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	layout.Windows[0].ID = "changed"
+	layout.Windows[0].Tabs[0].ID = "changed"
+	layout.Windows[0].Tabs[0].Root.Children[0].Session.Title = "changed"
+
+	layout, err = cache.Layout()
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	if _, ok := layout.Window(wid); !ok {
+		t.Fatalf("window %s not in the cached layout after changing a copy", wid)
+	}
+	if _, ok := layout.Tab(tid); !ok {
+		t.Fatalf("tab %s not in the cached layout after changing a copy", tid)
+	}
+	if session, ok := layout.Session(sid); !ok || session.Title == "changed" {
+		t.Fatalf("cached session = %+v, %v, want it unchanged", session, ok)
+	}
+}
+
+func TestStateCacheReloadKeepsNewerLayout(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	_, tid, sid := srv.CreateWindow()
+
+	// change the layout while the cache loads, after it listed the sessions
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetFocusRequest() != nil {
+			srv.Handle(nil)
+			srv.SetTmux(tid, "1", "@1", sid)
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	})
+	cache := enableStateCache(t, app)
+
+	layout, err := cache.Layout()
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	if tab, _ := layout.Tab(tid); tab.TmuxConnectionID != "1" {
+		t.Fatalf("tab = %+v, want the layout of the notification", tab)
+	}
+}
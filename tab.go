@@ -1,7 +1,9 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
+	"slices"
 
 	"github.com/trzsz/iterm2/api"
 )
@@ -39,36 +41,32 @@ func (t *Tab) GetTabID() string {
 
 // SetTitle changes the tab’s title
 func (t *Tab) SetTitle(s string) error {
+	return t.SetTitleContext(context.Background(), s)
+}
+
+// SetTitleContext is like SetTitle but takes a context
+func (t *Tab) SetTitleContext(ctx context.Context, s string) error {
 	invocation := fmt.Sprintf(`iterm2.set_title(title: "%s")`, s)
-	resp, err := t.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{
-			InvokeFunctionRequest: &api.InvokeFunctionRequest{
-				Invocation: &invocation,
-				Context: &api.InvokeFunctionRequest_Method_{
-					Method: &api.InvokeFunctionRequest_Method{
-						Receiver: &t.tid,
-					},
-				},
+	_, err := Do[*api.InvokeFunctionResponse](ctx, t.app, &api.InvokeFunctionRequest{
+		Invocation: &invocation,
+		Context: &api.InvokeFunctionRequest_Method_{
+			Method: &api.InvokeFunctionRequest_Method{
+				Receiver: &t.tid,
 			},
 		},
 	})
-	if err != nil {
-		return fmt.Errorf("call set_title failed: %w", err)
-	}
-	ifResp := resp.GetInvokeFunctionResponse()
-	if ifResp == nil {
-		return fmt.Errorf("invoke_function_response is nil")
-	}
-	if err := ifResp.GetError(); err != nil {
-		return fmt.Errorf("set_title error: %s", err.GetErrorReason())
-	}
-	return nil
+	return err
 }
 
 // ListSessions retrieves all sessions in this tab
 func (t *Tab) ListSessions() ([]*Session, error) {
+	return t.ListSessionsContext(context.Background())
+}
+
+// ListSessionsContext is like ListSessions but takes a context
+func (t *Tab) ListSessionsContext(ctx context.Context) ([]*Session, error) {
 	var sessions []*Session
-	_, err := findSessionByMatch(t.app, func(wid, tid, sid string) bool {
+	_, err := findSessionByMatch(ctx, t.app, func(wid, tid, sid string) bool {
 		if wid == t.wid && tid == t.tid {
 			sessions = append(sessions, newSession(t.app, wid, tid, sid))
 		}
@@ -82,3 +80,35 @@ func (t *Tab) ListSessions() ([]*Session, error) {
 	}
 	return sessions, nil
 }
+
+// MoveTo moves the tab to the given position of window, which may be its own window.
+// An index out of range puts the tab last. A window left without tabs is closed.
+func (t *Tab) MoveTo(window *Window, index int) error {
+	return t.MoveToContext(context.Background(), window, index)
+}
+
+// MoveToContext is like MoveTo but takes a context
+func (t *Tab) MoveToContext(ctx context.Context, window *Window, index int) error {
+	layout, err := t.app.LayoutContext(ctx)
+	if err != nil {
+		return err
+	}
+	target, ok := layout.Window(window.wid)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrWindowNotFound, window.wid)
+	}
+	tids := make([]string, 0, len(target.Tabs)+1)
+	for _, other := range target.Tabs {
+		if other.ID != t.tid {
+			tids = append(tids, other.ID)
+		}
+	}
+	if index < 0 || index > len(tids) {
+		index = len(tids)
+	}
+	if err := window.setTabOrder(ctx, slices.Insert(tids, index, t.tid)); err != nil {
+		return err
+	}
+	t.wid = window.wid
+	return nil
+}
@@ -0,0 +1,34 @@
+package iterm2_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/trzsz/iterm2"
+)
+
+func TestMoveTo(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	w, tabs := createTabs(t, app, 2)
+	other, moved := createTabs(t, app, 2)
+
+	if err := moved[0].MoveTo(w, 1); err != nil {
+		t.Fatalf("move tab failed: %v", err)
+	}
+	if moved[0].GetWindowID() != w.GetWindowID() {
+		t.Fatalf("moved tab window = %s, want %s", moved[0].GetWindowID(), w.GetWindowID())
+	}
+	if err := moved[1].MoveTo(w, 10); err != nil {
+		t.Fatalf("move tab past the end failed: %v", err)
+	}
+	want := [][]string{{tabs[0].GetTabID(), moved[0].GetTabID(), tabs[1].GetTabID(), moved[1].GetTabID()}}
+	if got := tabOrder(t, app); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Fatalf("tab order = %v, want %v", got, want)
+	}
+
+	if err := tabs[0].MoveTo(other, 0); !errors.Is(err, iterm2.ErrWindowNotFound) {
+		t.Fatalf("move tab to a closed window error = %v, want %v", err, iterm2.ErrWindowNotFound)
+	}
+}
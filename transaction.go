@@ -0,0 +1,55 @@
+package iterm2
+
+import (
+	"context"
+	"errors"
+
+	"github.com/trzsz/iterm2/api"
+)
+
+// Tx is an open transaction, see App.Transaction
+type Tx struct {
+	app *App
+	ctx context.Context
+}
+
+// App returns the App running the transaction
+func (tx *Tx) App() *App {
+	return tx.app
+}
+
+// Context returns the context passed to App.Transaction.
+// Pass it to the Context variants of the methods called in the transaction.
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// Transaction runs fn while iTerm2 has its main thread frozen, so that every
+// call made by fn sees a consistent state, e.g. the sessions, the focus and
+// the variables are not changed in between by the user. The transaction is
+// ended when fn returns, even if fn fails or panics. fn must not take long as
+// iTerm2 does not respond to the user meanwhile, and must not call Transaction.
+func (a *App) Transaction(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	if err := a.transaction(ctx, true); err != nil {
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			// iTerm2 may have begun the transaction before ctx was done or the call failed
+			_ = a.transaction(context.WithoutCancel(ctx), false)
+		}
+		return err
+	}
+	defer func() {
+		// end the transaction even if ctx is done, iTerm2 would stay frozen otherwise
+		if endErr := a.transaction(context.WithoutCancel(ctx), false); endErr != nil {
+			err = errors.Join(err, endErr)
+		}
+	}()
+	return fn(&Tx{app: a, ctx: ctx})
+}
+
+func (a *App) transaction(ctx context.Context, begin bool) error {
+	_, err := Do[*api.TransactionResponse](ctx, a, &api.TransactionRequest{
+		Begin: &begin,
+	})
+	return err
+}
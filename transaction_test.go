@@ -0,0 +1,96 @@
+package iterm2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trzsz/iterm2"
+	"github.com/trzsz/iterm2/api"
+)
+
+// noop runs an empty transaction, failing the test if iTerm2 is still in a transaction
+func noop(t *testing.T, app *iterm2.App) {
+	t.Helper()
+	if err := app.Transaction(context.Background(), func(*iterm2.Tx) error { return nil }); err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	srv.CreateWindow()
+
+	err := app.Transaction(context.Background(), func(tx *iterm2.Tx) error {
+		windows, err := tx.App().ListWindowsContext(tx.Context())
+		if err != nil || len(windows) != 1 {
+			t.Errorf("list windows in transaction = %v, %v, want one window", windows, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	noop(t, app)
+}
+
+func TestTransactionEndsOnError(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	failed := errors.New("failed")
+	if err := app.Transaction(context.Background(), func(*iterm2.Tx) error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("transaction error = %v, want %v", err, failed)
+	}
+	noop(t, app)
+}
+
+func TestTransactionEndsOnPanic(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("recovered %v, want the panic of fn", r)
+			}
+		}()
+		_ = app.Transaction(context.Background(), func(*iterm2.Tx) error { panic("boom") })
+	}()
+	noop(t, app)
+}
+
+func TestNestedTransaction(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	err := app.Transaction(context.Background(), func(tx *iterm2.Tx) error {
+		return tx.App().Transaction(tx.Context(), func(*iterm2.Tx) error { return nil })
+	})
+	if !errors.Is(err, iterm2.ErrAlreadyInTransaction) {
+		t.Fatalf("nested transaction error = %v, want %v", err, iterm2.ErrAlreadyInTransaction)
+	}
+	noop(t, app)
+}
+
+func TestTransactionBeginTimeout(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+
+	// iTerm2 begins the transaction but answers after the deadline
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetTransactionRequest().GetBegin() {
+			srv.Handle(nil)
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := app.Transaction(ctx, func(*iterm2.Tx) error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("transaction error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	noop(t, app)
+}
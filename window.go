@@ -1,7 +1,9 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"strconv"
 
 	"github.com/trzsz/iterm2/api"
@@ -29,52 +31,36 @@ func (w *Window) GetWindowID() string {
 
 // SetTitle changes the window’s title
 func (w *Window) SetTitle(s string) error {
+	return w.SetTitleContext(context.Background(), s)
+}
+
+// SetTitleContext is like SetTitle but takes a context
+func (w *Window) SetTitleContext(ctx context.Context, s string) error {
 	invocation := fmt.Sprintf(`iterm2.set_title(title: "%s")`, s)
-	resp, err := w.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{
-			InvokeFunctionRequest: &api.InvokeFunctionRequest{
-				Invocation: &invocation,
-				Context: &api.InvokeFunctionRequest_Method_{
-					Method: &api.InvokeFunctionRequest_Method{
-						Receiver: &w.wid,
-					},
-				},
+	_, err := Do[*api.InvokeFunctionResponse](ctx, w.app, &api.InvokeFunctionRequest{
+		Invocation: &invocation,
+		Context: &api.InvokeFunctionRequest_Method_{
+			Method: &api.InvokeFunctionRequest_Method{
+				Receiver: &w.wid,
 			},
 		},
 	})
-	if err != nil {
-		return fmt.Errorf("call set_title failed: %w", err)
-	}
-
-	ifResp := resp.GetInvokeFunctionResponse()
-	if ifResp == nil {
-		return fmt.Errorf("invoke_function_response is nil")
-	}
-	if err := ifResp.GetError(); err != nil {
-		return fmt.Errorf("set_title error: %s", err.GetErrorReason())
-	}
-	return nil
+	return err
 }
 
 // CreateTab creates a new tab in this window
 func (w *Window) CreateTab() (*Tab, *Session, error) {
-	resp, err := w.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{
-			CreateTabRequest: &api.CreateTabRequest{
-				WindowId: &w.wid,
-			},
-		},
+	return w.CreateTabContext(context.Background())
+}
+
+// CreateTabContext is like CreateTab but takes a context
+func (w *Window) CreateTabContext(ctx context.Context) (*Tab, *Session, error) {
+	ctResp, err := Do[*api.CreateTabResponse](ctx, w.app, &api.CreateTabRequest{
+		WindowId: &w.wid,
 	})
+	w.app.invalidateCache()
 	if err != nil {
-		return nil, nil, fmt.Errorf("call create_tab_request failed: %w", err)
-	}
-
-	ctResp := resp.GetCreateTabResponse()
-	if ctResp == nil {
-		return nil, nil, fmt.Errorf("create_tab_response is nil")
-	}
-	if ctResp.GetStatus() != api.CreateTabResponse_OK {
-		return nil, nil, fmt.Errorf("create_tab_response status is not ok: %v", ctResp.GetStatus())
+		return nil, nil, err
 	}
 
 	session := newSession(w.app, ctResp.GetWindowId(), strconv.Itoa(int(ctResp.GetTabId())), ctResp.GetSessionId())
@@ -83,28 +69,154 @@ func (w *Window) CreateTab() (*Tab, *Session, error) {
 
 // ListTabs retrieves all tabs in this window
 func (w *Window) ListTabs() ([]*Tab, error) {
-	resp, err := w.app.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
-			ListSessionsRequest: &api.ListSessionsRequest{},
-		},
-	})
+	return w.ListTabsContext(context.Background())
+}
+
+// ListTabsContext is like ListTabs but takes a context
+func (w *Window) ListTabsContext(ctx context.Context) ([]*Tab, error) {
+	layout, err := w.app.LayoutContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("call list_sessions_request failed: %w", err)
+		return nil, err
+	}
+	window, ok := layout.Window(w.wid)
+	if !ok {
+		return nil, fmt.Errorf("window not found: %v", w.wid)
 	}
+	list := make([]*Tab, 0, len(window.Tabs))
+	for _, t := range window.Tabs {
+		list = append(list, newTab(w.app, w.wid, t.ID))
+	}
+	return list, nil
+}
+
+// Frame returns the position and size of the window, in points from the bottom left corner of the screen
+func (w *Window) Frame() (Rect, error) {
+	return w.FrameContext(context.Background())
+}
 
-	lsResp := resp.GetListSessionsResponse()
-	if lsResp == nil {
-		return nil, fmt.Errorf("list_sessions_response is nil")
+// FrameContext is like Frame but takes a context
+func (w *Window) FrameContext(ctx context.Context) (Rect, error) {
+	var frame jsonRect
+	if err := getProperty(ctx, w.app, w.getPropertyRequest("frame"), &frame); err != nil {
+		return Rect{}, err
 	}
-	for _, window := range lsResp.GetWindows() {
-		if window.GetWindowId() == w.wid {
-			tabs := window.GetTabs()
-			list := make([]*Tab, 0, len(tabs))
-			for _, t := range tabs {
-				list = append(list, newTab(w.app, w.wid, t.GetTabId()))
-			}
-			return list, nil
+	return frame.rect(), nil
+}
+
+// SetFrame moves and resizes the window. It fails with ErrImpossible for a full screen window.
+func (w *Window) SetFrame(frame Rect) error {
+	return w.SetFrameContext(context.Background(), frame)
+}
+
+// SetFrameContext is like SetFrame but takes a context
+func (w *Window) SetFrameContext(ctx context.Context, frame Rect) error {
+	err := setProperty(ctx, w.app, w.setPropertyRequest("frame"), newJSONRect(frame), nil)
+	w.app.invalidateCache()
+	return err
+}
+
+// IsFullscreen reports whether the window is full screen
+func (w *Window) IsFullscreen() (bool, error) {
+	return w.IsFullscreenContext(context.Background())
+}
+
+// IsFullscreenContext is like IsFullscreen but takes a context
+func (w *Window) IsFullscreenContext(ctx context.Context) (bool, error) {
+	var fullscreen bool
+	err := getProperty(ctx, w.app, w.getPropertyRequest("fullscreen"), &fullscreen)
+	return fullscreen, err
+}
+
+// SetFullscreen enters or exits full screen. Toggling may fail with ErrFailed
+// while another window is toggling, pass RetryOptions to try again, or nil not to.
+func (w *Window) SetFullscreen(fullscreen bool, retry *RetryOptions) error {
+	return w.SetFullscreenContext(context.Background(), fullscreen, retry)
+}
+
+// SetFullscreenContext is like SetFullscreen but takes a context
+func (w *Window) SetFullscreenContext(ctx context.Context, fullscreen bool, retry *RetryOptions) error {
+	err := setProperty(ctx, w.app, w.setPropertyRequest("fullscreen"), fullscreen, retry)
+	w.app.invalidateCache()
+	return err
+}
+
+func (w *Window) getPropertyRequest(name string) *api.GetPropertyRequest {
+	return &api.GetPropertyRequest{
+		Identifier: &api.GetPropertyRequest_WindowId{WindowId: w.wid},
+		Name:       &name,
+	}
+}
+
+func (w *Window) setPropertyRequest(name string) *api.SetPropertyRequest {
+	return &api.SetPropertyRequest{
+		Identifier: &api.SetPropertyRequest_WindowId{WindowId: w.wid},
+		Name:       &name,
+	}
+}
+
+// SetTabOrder puts the tabs first in this window, in the given order, moving them from
+// other windows as needed. The other tabs of this window stay after them, and windows
+// left without tabs are closed. A tab given twice fails with ErrInvalidAssignment,
+// and a tab that does not exist with ErrTabNotFound.
+func (w *Window) SetTabOrder(tabs ...*Tab) error {
+	return w.SetTabOrderContext(context.Background(), tabs...)
+}
+
+// SetTabOrderContext is like SetTabOrder but takes a context
+func (w *Window) SetTabOrderContext(ctx context.Context, tabs ...*Tab) error {
+	tids := make([]string, 0, len(tabs))
+	for _, t := range tabs {
+		tids = append(tids, t.tid)
+	}
+	if err := w.setTabOrder(ctx, tids); err != nil {
+		return err
+	}
+	for _, t := range tabs {
+		t.wid = w.wid
+	}
+	return nil
+}
+
+func (w *Window) setTabOrder(ctx context.Context, tids []string) error {
+	_, err := Do[*api.ReorderTabsResponse](ctx, w.app, &api.ReorderTabsRequest{
+		Assignments: []*api.ReorderTabsRequest_Assignment{{
+			WindowId: &w.wid,
+			TabIds:   tids,
+		}},
+	})
+	w.app.invalidateCache()
+	return err
+}
+
+// SortTabs reorders the tabs of this window so that less(a, b) holds for every tab a
+// before a tab b. Tabs that are equal keep their order.
+func (w *Window) SortTabs(less func(a, b TabInfo) bool) error {
+	return w.SortTabsContext(context.Background(), less)
+}
+
+// SortTabsContext is like SortTabs but takes a context
+func (w *Window) SortTabsContext(ctx context.Context, less func(a, b TabInfo) bool) error {
+	layout, err := w.app.LayoutContext(ctx)
+	if err != nil {
+		return err
+	}
+	window, ok := layout.Window(w.wid)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrWindowNotFound, w.wid)
+	}
+	tabs := slices.Clone(window.Tabs)
+	slices.SortStableFunc(tabs, func(a, b TabInfo) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
 		}
+		return 0
+	})
+	tids := make([]string, 0, len(tabs))
+	for _, t := range tabs {
+		tids = append(tids, t.ID)
 	}
-	return nil, fmt.Errorf("window not found: %v", w.wid)
+	return w.setTabOrder(ctx, tids)
 }
@@ -0,0 +1,97 @@
+package iterm2_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/trzsz/iterm2"
+)
+
+// tabOrder returns the tab ids of every window, in order
+func tabOrder(t *testing.T, app *iterm2.App) [][]string {
+	t.Helper()
+	layout, err := app.Layout()
+	if err != nil {
+		t.Fatalf("layout failed: %v", err)
+	}
+	var order [][]string
+	for _, w := range layout.Windows {
+		var ids []string
+		for _, tab := range w.Tabs {
+			ids = append(ids, tab.ID)
+		}
+		order = append(order, ids)
+	}
+	return order
+}
+
+// createTabs creates a window with n tabs
+func createTabs(t *testing.T, app *iterm2.App, n int) (*iterm2.Window, []*iterm2.Tab) {
+	t.Helper()
+	w, s, err := app.CreateWindow()
+	if err != nil {
+		t.Fatalf("create window failed: %v", err)
+	}
+	tabs := []*iterm2.Tab{s.GetTab()}
+	for len(tabs) < n {
+		tab, _, err := w.CreateTab()
+		if err != nil {
+			t.Fatalf("create tab failed: %v", err)
+		}
+		tabs = append(tabs, tab)
+	}
+	return w, tabs
+}
+
+func TestSetTabOrder(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	w, tabs := createTabs(t, app, 3)
+	_, others := createTabs(t, app, 1)
+
+	if err := w.SetTabOrder(tabs[2], tabs[0]); err != nil {
+		t.Fatalf("set tab order failed: %v", err)
+	}
+	want := [][]string{{tabs[2].GetTabID(), tabs[0].GetTabID(), tabs[1].GetTabID()}, {others[0].GetTabID()}}
+	if got := tabOrder(t, app); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Fatalf("tab order = %v, want %v", got, want)
+	}
+
+	// moving the last tab of a window closes it
+	if err := w.SetTabOrder(others[0]); err != nil {
+		t.Fatalf("set tab order failed: %v", err)
+	}
+	if others[0].GetWindowID() != w.GetWindowID() {
+		t.Fatalf("moved tab window = %s, want %s", others[0].GetWindowID(), w.GetWindowID())
+	}
+	want = [][]string{{others[0].GetTabID(), tabs[2].GetTabID(), tabs[0].GetTabID(), tabs[1].GetTabID()}}
+	if got := tabOrder(t, app); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Fatalf("tab order = %v, want %v", got, want)
+	}
+
+	if err := w.SetTabOrder(tabs[0], tabs[0]); !errors.Is(err, iterm2.ErrInvalidAssignment) {
+		t.Fatalf("set tab order with a tab twice error = %v, want %v", err, iterm2.ErrInvalidAssignment)
+	}
+	if err := tabs[1].Close(true); err != nil {
+		t.Fatalf("close tab failed: %v", err)
+	}
+	if err := w.SetTabOrder(tabs[1]); !errors.Is(err, iterm2.ErrTabNotFound) {
+		t.Fatalf("set tab order with a closed tab error = %v, want %v", err, iterm2.ErrTabNotFound)
+	}
+}
+
+func TestSortTabs(t *testing.T) {
+	srv := newTestServer(t)
+	app := newTestApp(t, srv)
+	w, tabs := createTabs(t, app, 3)
+	rank := map[string]int{tabs[0].GetTabID(): 2, tabs[1].GetTabID(): 3, tabs[2].GetTabID(): 1}
+
+	if err := w.SortTabs(func(a, b iterm2.TabInfo) bool { return rank[a.ID] < rank[b.ID] }); err != nil {
+		t.Fatalf("sort tabs failed: %v", err)
+	}
+	want := [][]string{{tabs[2].GetTabID(), tabs[0].GetTabID(), tabs[1].GetTabID()}}
+	if got := tabOrder(t, app); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Fatalf("tab order = %v, want %v", got, want)
+	}
+}